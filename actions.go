@@ -0,0 +1,232 @@
+package herfish
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var ErrNotConfirmed = errors.New("refusing to modify repositories without --yes")
+
+// checkoutRepos checks out branch in every clean repo. Dirty repos, and
+// repos with untracked files the branch would overwrite, are skipped so
+// uncommitted work is never touched.
+func checkoutRepos(filteredData []templateData, branch string) error {
+	var checkedOut, skipped, failed int
+
+	for _, data := range filteredData {
+		reason, err := modifyBlocker(data.Dir, branchCommit(branch))
+		if err != nil {
+			slog.Error("failed to get repo status", "dir", data.Dir, "error", err)
+			failed++
+			continue
+		}
+
+		if reason != "" {
+			fmt.Printf("%s: skipped (%s)\n", data.Dir, reason)
+			skipped++
+			continue
+		}
+
+		if err := checkoutBranch(data.Dir, branch); err != nil {
+			slog.Error("checkout failed", "dir", data.Dir, "branch", branch, "error", err)
+			failed++
+			continue
+		}
+
+		fmt.Printf("%s: checked out %s\n", data.Dir, branch)
+		checkedOut++
+	}
+
+	fmt.Printf("checkout complete: %d checked out, %d skipped, %d failed\n", checkedOut, skipped, failed)
+
+	if failed > 0 {
+		return fmt.Errorf("checkout failed in %d of %d repos", failed, len(filteredData))
+	}
+
+	return nil
+}
+
+// targetCommit resolves the commit an action will move the worktree to, or
+// nil when there is none.
+type targetCommit func(repo *git.Repository) (*object.Commit, error)
+
+// modifyBlocker returns why dir must not be modified by an action, or ""
+// when it is safe. It always runs a full worktree status: --fast-status may
+// report a modified repo as clean, which is fine for reporting but not for
+// deciding whether a checkout or pull may touch the worktree. go-git
+// silently overwrites untracked files that the target commit tracks, where
+// git refuses, so those block the action too.
+func modifyBlocker(dir string, target targetCommit) (string, error) {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return "", fmt.Errorf("error getting worktree: %w", err)
+	}
+
+	status, err := wt.Status()
+	if err != nil {
+		return "", fmt.Errorf("error getting status: %w", err)
+	}
+
+	for _, s := range status {
+		if s.Worktree == git.Untracked {
+			continue
+		}
+		if s.Worktree != git.Unmodified || s.Staging != git.Unmodified {
+			return "dirty", nil
+		}
+	}
+
+	if target == nil {
+		return "", nil
+	}
+	commit, err := target(repo)
+	if err != nil || commit == nil {
+		return "", err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return "", fmt.Errorf("failed to read tree of %s: %w", commit.Hash, err)
+	}
+
+	for path, s := range status {
+		if s.Worktree != git.Untracked {
+			continue
+		}
+		if _, err := tree.FindEntry(path); err == nil {
+			return fmt.Sprintf("untracked %s would be overwritten", path), nil
+		}
+	}
+
+	return "", nil
+}
+
+// branchCommit targets the tip of a local branch. A missing branch has no
+// target; the checkout itself reports it.
+func branchCommit(branch string) targetCommit {
+	return func(repo *git.Repository) (*object.Commit, error) {
+		ref, err := repo.Reference(plumbing.NewBranchReferenceName(branch), true)
+		if err != nil {
+			return nil, nil
+		}
+		return repo.CommitObject(ref.Hash())
+	}
+}
+
+func checkoutBranch(dir, branch string) error {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("error getting worktree: %w", err)
+	}
+
+	return wt.Checkout(&git.CheckoutOptions{
+		Branch: plumbing.NewBranchReferenceName(branch),
+	})
+}
+
+// pullRepos fast-forwards every clean repo whose current branch has an
+// upstream. Dirty repos, repos with untracked files the pull would
+// overwrite, and repos without an upstream are skipped.
+func pullRepos(filteredData []templateData) error {
+	var updated, upToDate, skipped, failed int
+
+	for _, data := range filteredData {
+		reason, err := modifyBlocker(data.Dir, upstreamCommit)
+		if err != nil {
+			slog.Error("failed to get repo status", "dir", data.Dir, "error", err)
+			failed++
+			continue
+		}
+
+		if reason != "" {
+			fmt.Printf("%s: skipped (%s)\n", data.Dir, reason)
+			skipped++
+			continue
+		}
+
+		err = pullRepo(data.Dir)
+		switch {
+		case errors.Is(err, git.NoErrAlreadyUpToDate):
+			fmt.Printf("%s: already up to date\n", data.Dir)
+			upToDate++
+		case errors.Is(err, ErrNoUpstream):
+			fmt.Printf("%s: skipped (no upstream)\n", data.Dir)
+			skipped++
+		case err != nil:
+			slog.Error("pull failed", "dir", data.Dir, "error", err)
+			failed++
+		default:
+			fmt.Printf("%s: updated\n", data.Dir)
+			updated++
+		}
+	}
+
+	fmt.Printf("pull complete: %d updated, %d already up to date, %d skipped, %d failed\n", updated, upToDate, skipped, failed)
+
+	if failed > 0 {
+		return fmt.Errorf("pull failed in %d of %d repos", failed, len(filteredData))
+	}
+
+	return nil
+}
+
+// upstreamCommit fetches the current branch's upstream and targets its tip,
+// so a pull can be checked before it touches the worktree. A branch without
+// an upstream has no target; the pull itself reports it.
+func upstreamCommit(repo *git.Repository) (*object.Commit, error) {
+	_, branch, err := currentBranchConfig(repo)
+	if err != nil {
+		return nil, nil
+	}
+
+	err = repo.Fetch(&git.FetchOptions{RemoteName: branch.Remote})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil, fmt.Errorf("failed to fetch %s: %w", branch.Remote, err)
+	}
+
+	name := plumbing.NewRemoteReferenceName(branch.Remote, branch.Merge.Short())
+	ref, err := repo.Reference(name, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", name, err)
+	}
+
+	return repo.CommitObject(ref.Hash())
+}
+
+func pullRepo(dir string) error {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	_, branch, err := currentBranchConfig(repo)
+	if err != nil {
+		return err
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("error getting worktree: %w", err)
+	}
+
+	// go-git only performs fast-forward pulls and fails otherwise.
+	return wt.Pull(&git.PullOptions{
+		RemoteName:    branch.Remote,
+		ReferenceName: branch.Merge,
+		SingleBranch:  true,
+	})
+}
@@ -0,0 +1,11 @@
+package herfish
+
+import "regexp"
+
+// ansiPattern matches CSI escape sequences such as color codes and cursor
+// movement, plus OSC sequences like terminal hyperlinks.
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)`)
+
+func stripANSI(b []byte) []byte {
+	return ansiPattern.ReplaceAll(b, nil)
+}
@@ -0,0 +1,46 @@
+package herfish
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStripANSI(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "plain", want: "plain"},
+		{in: "\x1b[31mred\x1b[0m", want: "red"},
+		{in: "\x1b[1;32mbold green\x1b[m", want: "bold green"},
+		{in: "\x1b[2K\x1b[?25lcursor", want: "cursor"},
+		{in: "\x1b]8;;https://example.com\x07link\x1b]8;;\x07", want: "link"},
+		{in: "\x1b]8;;https://example.com\x1b\\link\x1b]8;;\x1b\\", want: "link"},
+	}
+
+	for _, tt := range tests {
+		if got := string(stripANSI([]byte(tt.in))); got != tt.want {
+			t.Errorf("stripANSI(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestOutputFileHasNoANSI(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "out.txt")
+	setOptions(t, "--output-file", file, "--template", "\x1b[31m{{.Dir}}\x1b[0m")
+
+	outputResults([]templateData{{Dir: "/a"}, {Dir: "/b"}}, nil)
+
+	got, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.IndexByte(got, 0x1b) != -1 {
+		t.Errorf("output file contains escape bytes: %q", got)
+	}
+	if want := "/a\n/b\n"; string(got) != want {
+		t.Errorf("output file = %q, want %q", got, want)
+	}
+}
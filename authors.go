@@ -0,0 +1,35 @@
+package herfish
+
+import (
+	"cmp"
+	"slices"
+)
+
+func authorsEnabled() bool {
+	return opts.ByAuthor || templateReferences("Authors")
+}
+
+// topAuthors keeps the limit authors with the most commits, breaking ties by
+// email so the cut is stable. A limit of 0 keeps everyone.
+func topAuthors(authors map[string]int, limit int) map[string]int {
+	if limit <= 0 || len(authors) <= limit {
+		return authors
+	}
+
+	emails := make([]string, 0, len(authors))
+	for email := range authors {
+		emails = append(emails, email)
+	}
+	slices.SortFunc(emails, func(a, b string) int {
+		if c := cmp.Compare(authors[b], authors[a]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	})
+
+	top := make(map[string]int, limit)
+	for _, email := range emails[:limit] {
+		top[email] = authors[email]
+	}
+	return top
+}
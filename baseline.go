@@ -0,0 +1,48 @@
+package herfish
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// readBaseline loads commit counts from a previous run's --output json file,
+// keyed by absolute repository path.
+func readBaseline(file string) (map[string]int, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline: %w", err)
+	}
+
+	var previous []templateData
+	if err := json.Unmarshal(b, &previous); err != nil {
+		return nil, fmt.Errorf("baseline must be --output json from a previous run: %w", err)
+	}
+
+	// Before JSON output always counted, a plain --output json run wrote
+	// commit_count 0 and repo_status "unknown" for every repo. Deltas against
+	// such a file would equal the full counts, so refuse it.
+	if len(previous) > 0 && !slices.ContainsFunc(previous, func(data templateData) bool {
+		return data.CommitCount != 0 || data.RepoStatus != "unknown"
+	}) {
+		return nil, fmt.Errorf("baseline %s has no commit counts; regenerate it with --output json", file)
+	}
+
+	counts := make(map[string]int, len(previous))
+	for _, data := range previous {
+		key := data.AbsDir
+		if key == "" {
+			key = data.Dir
+		}
+		counts[key] = data.CommitCount
+	}
+
+	return counts, nil
+}
+
+// commitDelta returns the commits added since the baseline. A repository
+// missing from the baseline counts from zero.
+func commitDelta(data templateData) int {
+	return data.CommitCount - opts.baseline[data.AbsDir]
+}
@@ -0,0 +1,62 @@
+package herfish
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadBaseline(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    map[string]int
+		wantErr bool
+	}{
+		{
+			name: "counted",
+			json: `[{"dir":"a","abs_dir":"/a","commit_count":3,"repo_status":"clean"},{"dir":"/b","commit_count":0,"repo_status":"unknown"}]`,
+			want: map[string]int{"/a": 3, "/b": 0},
+		},
+		{
+			name:    "written without counts",
+			json:    `[{"dir":"/a","commit_count":0,"repo_status":"unknown"},{"dir":"/b","repo_status":"unknown"}]`,
+			wantErr: true,
+		},
+		{
+			name: "empty",
+			json: `[]`,
+			want: map[string]int{},
+		},
+		{
+			name:    "not an array",
+			json:    `{}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "baseline.json")
+			if err := os.WriteFile(file, []byte(tt.json), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readBaseline(file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readBaseline error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("readBaseline = %v, want %v", got, tt.want)
+			}
+			for dir, count := range tt.want {
+				if got[dir] != count {
+					t.Errorf("readBaseline[%q] = %d, want %d", dir, got[dir], count)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+package herfish
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var ErrNoDefaultBranch = errors.New("could not resolve default branch")
+
+// resolveDefaultBranch returns the default branch name and its tip. It uses
+// origin/HEAD when present and falls back to local main or master.
+func resolveDefaultBranch(repo *git.Repository) (string, *plumbing.Reference, error) {
+	originHead, err := repo.Reference(plumbing.NewRemoteHEADReferenceName("origin"), false)
+	if err == nil && originHead.Type() == plumbing.SymbolicReference {
+		ref, err := repo.Reference(originHead.Target(), true)
+		if err == nil {
+			name := strings.TrimPrefix(originHead.Target().Short(), "origin/")
+			return name, ref, nil
+		}
+	}
+
+	for _, name := range []string{"main", "master"} {
+		ref, err := repo.Reference(plumbing.NewBranchReferenceName(name), true)
+		if err == nil {
+			return name, ref, nil
+		}
+	}
+
+	return "", nil, ErrNoDefaultBranch
+}
+
+func branchChangesEnabled() bool {
+	return opts.OnlyWithChangesOnBranch || templateReferences("HasBranchChanges")
+}
+
+// hasBranchChanges reports whether HEAD has commits that are not reachable
+// from the default branch, i.e. work in progress on a feature branch.
+func hasBranchChanges(dir string) (bool, error) {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return false, fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return false, ErrNoGitLog
+	}
+
+	_, defaultRef, err := resolveDefaultBranch(repo)
+	if err != nil {
+		return false, err
+	}
+
+	headCommit, defaultCommit, err := commitPair(repo, head.Hash(), defaultRef.Hash())
+	if err != nil {
+		return false, err
+	}
+
+	merged, err := headCommit.IsAncestor(defaultCommit)
+	if err != nil {
+		return false, fmt.Errorf("failed to compare with default branch: %w", err)
+	}
+
+	return !merged, nil
+}
+
+func commitPair(repo *git.Repository, a, b plumbing.Hash) (*object.Commit, *object.Commit, error) {
+	commitA, err := repo.CommitObject(a)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read commit %s: %w", a, err)
+	}
+
+	commitB, err := repo.CommitObject(b)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read commit %s: %w", b, err)
+	}
+
+	return commitA, commitB, nil
+}
+
+var ErrNoUpstream = errors.New("current branch has no upstream")
+
+// currentBranchConfig returns the current branch name and its config entry
+// from .git/config, which records the tracked remote and merge ref.
+func currentBranchConfig(repo *git.Repository) (string, *config.Branch, error) {
+	head, err := repo.Head()
+	if err != nil {
+		return "", nil, ErrNoGitLog
+	}
+	if !head.Name().IsBranch() {
+		return "", nil, ErrNoUpstream
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	name := head.Name().Short()
+	branch, ok := cfg.Branches[name]
+	if !ok || branch.Remote == "" || branch.Merge == "" {
+		return name, nil, ErrNoUpstream
+	}
+
+	return name, branch, nil
+}
+
+func trackingRemoteEnabled() bool {
+	return templateReferences("TrackingRemote")
+}
+
+// trackingRemote returns the remote the current branch tracks, which need not
+// be origin in triangular workflows. It is empty when there is no upstream.
+func trackingRemote(dir string) (string, error) {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	_, branch, err := currentBranchConfig(repo)
+	if errors.Is(err, ErrNoUpstream) || errors.Is(err, ErrNoGitLog) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return branch.Remote, nil
+}
+
+func aheadBehindEnabled() bool {
+	return scoreEnabled() || templateReferences("Ahead") || templateReferences("Behind")
+}
+
+// aheadBehind counts commits on HEAD that are not on its upstream and
+// commits on the upstream that are not on HEAD. Both are zero when the
+// current branch has no upstream.
+func aheadBehind(dir string) (int, int, error) {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	_, branch, err := currentBranchConfig(repo)
+	if errors.Is(err, ErrNoUpstream) || errors.Is(err, ErrNoGitLog) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return 0, 0, ErrNoGitLog
+	}
+
+	upstreamName := plumbing.NewRemoteReferenceName(branch.Remote, branch.Merge.Short())
+	upstream, err := repo.Reference(upstreamName, true)
+	if err != nil {
+		slog.Debug("upstream ref not found", "dir", dir, "ref", upstreamName)
+		return 0, 0, nil
+	}
+
+	local, err := reachableCommits(repo, head.Hash())
+	if err != nil {
+		return 0, 0, err
+	}
+	remote, err := reachableCommits(repo, upstream.Hash())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	ahead, behind := 0, 0
+	for hash := range local {
+		if !remote[hash] {
+			ahead++
+		}
+	}
+	for hash := range remote {
+		if !local[hash] {
+			behind++
+		}
+	}
+
+	return ahead, behind, nil
+}
+
+func reachableCommits(repo *git.Repository, from plumbing.Hash) (map[plumbing.Hash]bool, error) {
+	iter, err := repo.Log(&git.LogOptions{From: from})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history of %s: %w", from, err)
+	}
+
+	seen := make(map[plumbing.Hash]bool)
+	err = forEachCommit(repo, iter, func(commit *object.Commit) error {
+		seen[commit.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate commits: %w", err)
+	}
+
+	return seen, nil
+}
+
+func aheadOfDefaultEnabled() bool {
+	return opts.HasUnmergedOnly || templateReferences("CommitsAheadOfDefault")
+}
+
+// commitsAheadOfDefault counts the commits on HEAD since its merge base with
+// the default branch, like git rev-list --count $(git merge-base main HEAD)..HEAD.
+func commitsAheadOfDefault(dir string) (int, error) {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return 0, ErrNoGitLog
+	}
+
+	_, defaultRef, err := resolveDefaultBranch(repo)
+	if err != nil {
+		return 0, err
+	}
+
+	headCommit, defaultCommit, err := commitPair(repo, head.Hash(), defaultRef.Hash())
+	if err != nil {
+		return 0, err
+	}
+
+	bases, err := headCommit.MergeBase(defaultCommit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find merge base: %w", err)
+	}
+
+	merged := make(map[plumbing.Hash]bool)
+	for _, base := range bases {
+		reachable, err := reachableCommits(repo, base.Hash)
+		if err != nil {
+			return 0, err
+		}
+		for hash := range reachable {
+			merged[hash] = true
+		}
+	}
+
+	onHead, err := reachableCommits(repo, head.Hash())
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for hash := range onHead {
+		if !merged[hash] {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func branchEnabled() bool {
+	return opts.OffDefaultOnly || templateReferences("Branch") || templateReferences("DefaultBranch")
+}
+
+// currentAndDefaultBranch returns the checked-out branch name, empty for a
+// detached HEAD, and the resolved default branch name.
+func currentAndDefaultBranch(dir string) (string, string, error) {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return "", "", ErrNoGitLog
+	}
+
+	branch := ""
+	if head.Name().IsBranch() {
+		branch = head.Name().Short()
+	}
+
+	defaultBranch, _, err := resolveDefaultBranch(repo)
+	if err != nil {
+		return branch, "", err
+	}
+
+	return branch, defaultBranch, nil
+}
+
+// ErrBrokenHead is a kind of ErrCorruptHead: HEAD names a branch that does
+// not exist although the repo has other branches.
+var ErrBrokenHead = fmt.Errorf("%w: HEAD points to a branch that does not exist", ErrCorruptHead)
+
+// danglingHead returns the ref a symbolic HEAD points to when that ref does
+// not exist although other branches do, e.g. after the checked-out branch
+// was deleted. A freshly initialized repo has no branches at all and is
+// reported as empty instead.
+func danglingHead(dir string) (string, bool) {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return "", false
+	}
+
+	head, err := repo.Reference(plumbing.HEAD, false)
+	if err != nil || head.Type() != plumbing.SymbolicReference {
+		return "", false
+	}
+
+	if _, err := repo.Reference(head.Target(), true); err == nil {
+		return "", false
+	}
+
+	branches, err := repo.Branches()
+	if err != nil {
+		return "", false
+	}
+	defer branches.Close()
+
+	if _, err := branches.Next(); err != nil {
+		return "", false
+	}
+
+	return head.Target().String(), true
+}
+
+// countAllBranchCommits counts the distinct commits reachable from any local
+// branch, so history on branches other than HEAD's is included.
+func countAllBranchCommits(dir string) (int, error) {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	branches, err := repo.Branches()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list branches: %w", err)
+	}
+
+	// One walk per branch, all sharing the seen set, so history common to
+	// several branches is visited only once.
+	seen := make(map[plumbing.Hash]bool)
+	err = branches.ForEach(func(ref *plumbing.Reference) error {
+		if seen[ref.Hash()] {
+			return nil
+		}
+		tip, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			return fmt.Errorf("failed to read history of %s: %w", ref.Name().Short(), err)
+		}
+		iter := object.NewCommitPreorderIter(tip, seen, nil)
+		err = forEachCommit(repo, iter, func(commit *object.Commit) error {
+			seen[commit.Hash] = true
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to iterate commits: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(seen), nil
+}
@@ -0,0 +1,62 @@
+package herfish
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestBranchEnabled(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{args: nil, want: false},
+		{args: []string{"--template", "{{.Branch}}"}, want: true},
+		{args: []string{"--template", "[{{.DefaultBranch}}]"}, want: true},
+		{args: []string{"--fields", "dir,default_branch"}, want: true},
+		{args: []string{"--off-default-only"}, want: true},
+		{args: []string{"--template", "{{.HasBranchChanges}}"}, want: false},
+	}
+
+	for _, tt := range tests {
+		setOptions(t, tt.args...)
+		if got := branchEnabled(); got != tt.want {
+			t.Errorf("branchEnabled() with %v = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestCountAllBranchCommitsCountsSharedHistoryOnce(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "repo")
+	if err := genFixture(dir, 3, false); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := openRepo(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tip, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, hash := range map[string]plumbing.Hash{"same": tip.Hash, "behind": tip.ParentHashes[0]} {
+		ref := plumbing.NewHashReference(plumbing.NewBranchReferenceName(name), hash)
+		if err := repo.Storer.SetReference(ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := countAllBranchCommits(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 3 {
+		t.Errorf("countAllBranchCommits() = %d, want 3", got)
+	}
+}
@@ -0,0 +1,337 @@
+package herfish
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// firstCommitCache maps "dir@head" to the root commit time so repeated scans
+// of an unchanged repo skip the history walk.
+var firstCommitCache sync.Map
+
+// templateReferences reports whether the user template or report template
+// refers to field or --fields selects it.
+func templateReferences(field string) bool {
+	if referencesField(opts.Template, field) || referencesField(opts.ReportTemplate, field) {
+		return true
+	}
+
+	if len(opts.fields) == 0 {
+		return false
+	}
+	f, ok := reflect.TypeFor[templateData]().FieldByName(field)
+	if !ok {
+		return false
+	}
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	return slices.Contains(opts.fields, name)
+}
+
+// referencesField reports whether text contains .field as a whole name, so
+// .CommitsAheadOfDefault does not count as a reference to Ahead or Default.
+func referencesField(text, field string) bool {
+	ref := "." + field
+	for i := strings.Index(text, ref); i != -1; {
+		end := i + len(ref)
+		if r, _ := utf8.DecodeRuneInString(text[end:]); end == len(text) || !isIdentRune(r) {
+			return true
+		}
+		next := strings.Index(text[end:], ref)
+		if next == -1 {
+			break
+		}
+		i = end + next
+	}
+	return false
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func firstCommitEnabled() bool {
+	return opts.Age || templateReferences("FirstCommitTime")
+}
+
+// firstCommitTime walks HEAD's history to its root commits and returns the
+// oldest root's committer time.
+func firstCommitTime(dir string) (time.Time, error) {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return time.Time{}, ErrNoGitLog
+	}
+
+	key := dir + "@" + head.Hash().String()
+	if cached, ok := firstCommitCache.Load(key); ok {
+		return cached.(time.Time), nil
+	}
+
+	iter, err := repo.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		return time.Time{}, ErrNoGitLog
+	}
+
+	var first time.Time
+	err = forEachCommit(repo, iter, func(commit *object.Commit) error {
+		if commit.NumParents() == 0 && (first.IsZero() || commit.Committer.When.Before(first)) {
+			first = commit.Committer.When
+		}
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to iterate commits: %w", err)
+	}
+
+	firstCommitCache.Store(key, first)
+
+	return first, nil
+}
+
+func tagCountEnabled() bool {
+	return opts.TagCountMin != -1 || opts.TagCountMax != -1 || templateReferences("TagCount")
+}
+
+func countTags(dir string) (int, error) {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	iter, err := repo.Tags()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list tags: %w", err)
+	}
+
+	count := 0
+	err = iter.ForEach(func(*plumbing.Reference) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to iterate tags: %w", err)
+	}
+
+	return count, nil
+}
+
+// tagsContainingHead lists, sorted by name, the tags whose commit is HEAD or
+// a descendant of it, like git tag --contains HEAD. At most limit names are
+// returned. Each tag costs an ancestry walk, hence the opt-in flag.
+func tagsContainingHead(dir string, limit int) ([]string, error) {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, ErrNoGitLog
+	}
+
+	headCommit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HEAD commit: %w", err)
+	}
+
+	iter, err := repo.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+
+	var tags []string
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		commit, err := tagCommit(repo, ref)
+		if err != nil {
+			slog.Debug("skipping tag without a commit", "dir", dir, "tag", ref.Name().Short(), "error", err)
+			return nil
+		}
+
+		contains := commit.Hash == headCommit.Hash
+		if !contains {
+			contains, err = headCommit.IsAncestor(commit)
+			if err != nil {
+				return fmt.Errorf("failed to check tag %s: %w", ref.Name().Short(), err)
+			}
+		}
+		if contains {
+			tags = append(tags, ref.Name().Short())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(tags)
+	if limit > 0 && len(tags) > limit {
+		tags = tags[:limit]
+	}
+
+	return tags, nil
+}
+
+// commitsSinceTag counts the commits on HEAD since the most recent tag
+// reachable from it, i.e. the unreleased changes. The most recent tag is the
+// reachable tagged commit with the newest committer time. It returns -1 when
+// no tag is reachable from HEAD.
+func commitsSinceTag(dir string) (int, error) {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return 0, ErrNoGitLog
+	}
+
+	tagged := make(map[plumbing.Hash]bool)
+	tags, err := repo.Tags()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list tags: %w", err)
+	}
+	err = tags.ForEach(func(ref *plumbing.Reference) error {
+		if commit, err := tagCommit(repo, ref); err == nil {
+			tagged[commit.Hash] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to iterate tags: %w", err)
+	}
+
+	iter, err := repo.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	onHead := 0
+	var latest *object.Commit
+	err = forEachCommit(repo, iter, func(commit *object.Commit) error {
+		onHead++
+		if tagged[commit.Hash] && (latest == nil || commit.Committer.When.After(latest.Committer.When)) {
+			latest = commit
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to iterate commits: %w", err)
+	}
+
+	if latest == nil {
+		return -1, nil
+	}
+
+	// Everything reachable from the tag is also reachable from HEAD, so the
+	// difference in history sizes is the size of tag..HEAD.
+	onTag, err := reachableCommits(repo, latest.Hash)
+	if err != nil {
+		return 0, err
+	}
+
+	return onHead - len(onTag), nil
+}
+
+// tagCommit peels a tag ref, lightweight or annotated, to its commit.
+func tagCommit(repo *git.Repository, ref *plumbing.Reference) (*object.Commit, error) {
+	tag, err := repo.TagObject(ref.Hash())
+	if err == nil {
+		return tag.Commit()
+	}
+	return repo.CommitObject(ref.Hash())
+}
+
+func notesEnabled() bool {
+	return opts.HasNotesOnly || templateReferences("HasNotes")
+}
+
+// hasNotes reports whether the repo has a refs/notes/commits ref.
+func hasNotes(dir string) (bool, error) {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return false, fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	_, err = repo.Reference(plumbing.ReferenceName("refs/notes/commits"), true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve notes ref: %w", err)
+	}
+
+	return true, nil
+}
+
+func lastCommitEnabled() bool {
+	return opts.Recent || opts.Sort == "last-commit" || opts.NewerThan != "" || scoreEnabled() || showTimes() ||
+		templateReferences("LastCommitTime")
+}
+
+// lastCommitTime returns the committer time of the HEAD commit.
+func lastCommitTime(dir string) (time.Time, error) {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return time.Time{}, ErrNoGitLog
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read HEAD commit: %w", err)
+	}
+
+	return commit.Committer.When, nil
+}
+
+// headSubject returns the first line of the HEAD commit message, cut to
+// width characters with a trailing ellipsis when longer. A width of 0 keeps
+// the whole line.
+func headSubject(dir string, width int) (string, error) {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return "", ErrNoGitLog
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return "", fmt.Errorf("failed to read HEAD commit: %w", err)
+	}
+
+	subject, _, _ := strings.Cut(strings.TrimSpace(commit.Message), "\n")
+	subject = strings.TrimSpace(subject)
+
+	runes := []rune(subject)
+	if width > 0 && len(runes) > width {
+		subject = string(runes[:max(width-1, 0)]) + "…"
+	}
+
+	return subject, nil
+}
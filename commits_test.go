@@ -0,0 +1,30 @@
+package herfish
+
+import "testing"
+
+func TestReferencesField(t *testing.T) {
+	tests := []struct {
+		text  string
+		field string
+		want  bool
+	}{
+		{text: "{{.Ahead}}", field: "Ahead", want: true},
+		{text: "{{.Ahead}} {{.Behind}}", field: "Behind", want: true},
+		{text: "{{.CommitsAheadOfDefault}}", field: "Ahead", want: false},
+		{text: "{{.DefaultBranch}}", field: "Branch", want: false},
+		{text: "{{.HasBranchChanges}} {{.CurrentBranchCommits}}", field: "Branch", want: false},
+		{text: "{{.BranchX}} {{.Branch}}", field: "Branch", want: true},
+		{text: "{{range .Repos}}{{.CommitCount}}{{end}}", field: "CommitCount", want: true},
+		{text: "{{.CommitCounts}}", field: "CommitCount", want: false},
+		{text: "{{.Origin | printf \"%s\"}}", field: "Origin", want: true},
+		{text: "Origin", field: "Origin", want: false},
+		{text: "", field: "Origin", want: false},
+		{text: "{{.Dir}}.Origin", field: "Origin", want: true},
+	}
+
+	for _, tt := range tests {
+		if got := referencesField(tt.text, tt.field); got != tt.want {
+			t.Errorf("referencesField(%q, %q) = %v, want %v", tt.text, tt.field, got, tt.want)
+		}
+	}
+}
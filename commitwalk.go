@@ -0,0 +1,35 @@
+package herfish
+
+import (
+	"errors"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// forEachCommit streams the commits of iter to fn one at a time and closes
+// iter. Every history walk goes through here so none of them collects
+// *object.Commit values: callers keep only what they aggregate (a count, a
+// timestamp, a set of hashes), and memory stays flat however long the
+// history is. In a shallow clone the walk ends quietly at commits whose
+// parents were never fetched, so results cover only the fetched depth.
+func forEachCommit(repo *git.Repository, iter object.CommitIter, fn func(*object.Commit) error) error {
+	defer iter.Close()
+
+	err := iter.ForEach(fn)
+	if truncatedByShallowClone(repo, err) {
+		return nil
+	}
+	return err
+}
+
+// truncatedByShallowClone reports whether err is a missing object in a
+// shallow clone, i.e. a walk that reached the edge of the fetched history.
+func truncatedByShallowClone(repo *git.Repository, err error) bool {
+	if !errors.Is(err, plumbing.ErrObjectNotFound) {
+		return false
+	}
+	shallow, _ := repo.Storer.Shallow()
+	return len(shallow) > 0
+}
@@ -0,0 +1,128 @@
+package herfish
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// linearHistory builds an in-memory repo whose master branch is a chain of
+// n empty commits, writing objects directly to skip worktree overhead.
+func linearHistory(tb testing.TB, n int) *git.Repository {
+	tb.Helper()
+
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	tree := repo.Storer.NewEncodedObject()
+	if err := (&object.Tree{}).Encode(tree); err != nil {
+		tb.Fatal(err)
+	}
+	treeHash, err := repo.Storer.SetEncodedObject(tree)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	var parent plumbing.Hash
+	for i := range n {
+		sig := object.Signature{Name: "herfish", Email: "herfish@example.com", When: fixtureEpoch.Add(time.Duration(i) * time.Minute)}
+		commit := &object.Commit{Author: sig, Committer: sig, Message: "commit\n", TreeHash: treeHash}
+		if !parent.IsZero() {
+			commit.ParentHashes = []plumbing.Hash{parent}
+		}
+
+		obj := repo.Storer.NewEncodedObject()
+		if err := commit.Encode(obj); err != nil {
+			tb.Fatal(err)
+		}
+		if parent, err = repo.Storer.SetEncodedObject(obj); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	if err := repo.Storer.SetReference(plumbing.NewHashReference("refs/heads/master", parent)); err != nil {
+		tb.Fatal(err)
+	}
+
+	return repo
+}
+
+func walkCount(tb testing.TB, repo *git.Repository, fn func(int)) int {
+	tb.Helper()
+
+	iter, err := repo.Log(&git.LogOptions{})
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	count := 0
+	err = forEachCommit(repo, iter, func(*object.Commit) error {
+		count++
+		if fn != nil {
+			fn(count)
+		}
+		return nil
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return count
+}
+
+// TestForEachCommitDoesNotRetainCommits walks a long history and checks the
+// commits handed to fn become garbage once fn returns, so memory is bounded
+// by what callers aggregate rather than by history length.
+func TestForEachCommitDoesNotRetainCommits(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a long history")
+	}
+
+	const n = 20000
+	repo := linearHistory(t, n)
+
+	var finalized atomic.Int64
+	got := walkCount(t, repo, nil)
+	if got != n {
+		t.Fatalf("walked %d commits, want %d", got, n)
+	}
+
+	iter, err := repo.Log(&git.LogOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = forEachCommit(repo, iter, func(commit *object.Commit) error {
+		runtime.SetFinalizer(commit, func(*object.Commit) { finalized.Add(1) })
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A handful may still be referenced by the finished iterator.
+	const slack = 16
+	for range 100 {
+		runtime.GC()
+		if finalized.Load() >= n-slack {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("%d of %d commits were collected after the walk, want at least %d", finalized.Load(), n, n-slack)
+}
+
+func BenchmarkForEachCommit(b *testing.B) {
+	repo := linearHistory(b, 10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		walkCount(b, repo, nil)
+	}
+}
@@ -0,0 +1,23 @@
+package herfish
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// exitPartial is returned by Execute when --deadline stopped the scan early.
+const exitPartial = 3
+
+var ErrDeadlineExceeded = errors.New("deadline exceeded")
+
+func deadlineExceeded() bool {
+	return !opts.deadlineAt.IsZero() && time.Now().After(opts.deadlineAt)
+}
+
+func deadlineError(skipped int) error {
+	if skipped == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %d repos not analyzed", ErrDeadlineExceeded, skipped)
+}
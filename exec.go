@@ -0,0 +1,95 @@
+package herfish
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// execInRepos runs command through the shell in each repo directory, with
+// {} replaced by the quoted repo path. Output lines are prefixed with the
+// repo path. At most concurrency commands run at once.
+func execInRepos(filteredData []templateData, command string, concurrency int) error {
+	var mu sync.Mutex
+	var failed []string
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for range max(concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dir := range jobs {
+				if err := execInRepo(dir, command, &mu); err != nil {
+					slog.Error("command failed", "dir", dir, "error", err)
+					mu.Lock()
+					failed = append(failed, dir)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, data := range filteredData {
+		jobs <- data.Dir
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return fmt.Errorf("command failed in %d of %d repos", len(failed), len(filteredData))
+	}
+
+	return nil
+}
+
+func execInRepo(dir, command string, mu *sync.Mutex) error {
+	script := strings.ReplaceAll(command, "{}", shellQuote(dir))
+	slog.Debug("running command", "dir", dir, "command", script)
+
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Dir = dir
+
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// ReadString has no line length limit, unlike bufio.Scanner, and
+		// whatever is left after a read error is drained so the child never
+		// blocks writing to the pipe.
+		reader := bufio.NewReader(pr)
+		for {
+			line, err := reader.ReadString('\n')
+			if line != "" {
+				mu.Lock()
+				fmt.Fprintf(os.Stdout, "%s: %s\n", dir, strings.TrimSuffix(line, "\n"))
+				mu.Unlock()
+			}
+			if err != nil {
+				if err != io.EOF {
+					slog.Warn("failed to read command output", "dir", dir, "error", err)
+				}
+				break
+			}
+		}
+		_, _ = io.Copy(io.Discard, pr)
+	}()
+
+	err := cmd.Run()
+	pw.Close()
+	<-done
+
+	return err
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
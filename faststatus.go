@@ -0,0 +1,94 @@
+package herfish
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// quickClean is the --fast-status approximation of a clean worktree. It
+// trusts the index: the worktree is considered clean when every tracked file
+// still has the size and mtime recorded in the index and the index matches
+// HEAD's tree. It returns false whenever it cannot tell, so callers fall back
+// to a full status. Like git without a racy-index check, a file rewritten
+// with the same size within the index's mtime granularity is missed and
+// reported clean. Untracked files are ignored, as they are by the full check.
+func quickClean(repo *git.Repository, dir string) bool {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		slog.Debug("fast status: failed to read index", "dir", dir, "error", err)
+		return false
+	}
+
+	for _, entry := range idx.Entries {
+		// Unmerged entries have a nonzero stage. index.Merged is 1 in go-git,
+		// not 0, so it cannot be used for this check.
+		if entry.Stage != 0 || entry.SkipWorktree || entry.IntentToAdd {
+			return false
+		}
+
+		info, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(entry.Name)))
+		if err != nil || uint32(info.Size()) != entry.Size || !info.ModTime().Equal(entry.ModifiedAt) {
+			slog.Debug("fast status: inconclusive", "dir", dir, "file", entry.Name)
+			return false
+		}
+	}
+
+	return indexMatchesHead(repo, idx, dir)
+}
+
+// indexMatchesHead reports whether the index has nothing staged, by comparing
+// its entries to HEAD's tree without reading any blobs.
+func indexMatchesHead(repo *git.Repository, idx *index.Index, dir string) bool {
+	head, err := repo.Head()
+	if err != nil {
+		return false
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return false
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return false
+	}
+
+	entries := make(map[string]*index.Entry, len(idx.Entries))
+	for _, entry := range idx.Entries {
+		entries[entry.Name] = entry
+	}
+
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+
+	seen := 0
+	for {
+		name, treeEntry, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			slog.Debug("fast status: failed to walk HEAD tree", "dir", dir, "error", err)
+			return false
+		}
+		if !treeEntry.Mode.IsFile() {
+			continue
+		}
+
+		entry, ok := entries[name]
+		if !ok || entry.Hash != treeEntry.Hash || entry.Mode != treeEntry.Mode {
+			slog.Debug("fast status: index differs from HEAD", "dir", dir, "file", name)
+			return false
+		}
+		seen++
+	}
+
+	return seen == len(entries)
+}
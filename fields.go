@@ -0,0 +1,69 @@
+package herfish
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// fieldIndexes maps the JSON name of each exported templateData field to its
+// index, so --fields uses the same names as JSON output.
+func fieldIndexes() map[string]int {
+	t := reflect.TypeFor[templateData]()
+	indexes := make(map[string]int, t.NumField())
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		indexes[name] = i
+	}
+	return indexes
+}
+
+// parseFields validates a comma-separated --fields list.
+func parseFields(list string) ([]string, error) {
+	indexes := fieldIndexes()
+
+	var fields []string
+	for field := range strings.SplitSeq(list, ",") {
+		field = strings.TrimSpace(field)
+		if _, ok := indexes[field]; !ok {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// writeFields prints the selected fields of each repository on one line,
+// joined by --field-separator.
+func writeFields(resultBuffer *bytes.Buffer, filteredData []templateData, fields []string, separator string) {
+	indexes := fieldIndexes()
+
+	for _, data := range filteredData {
+		v := reflect.ValueOf(data)
+		values := make([]string, len(fields))
+		for i, field := range fields {
+			values[i] = formatField(v.Field(indexes[field]).Interface())
+		}
+		resultBuffer.WriteString(strings.Join(values, separator) + "\n")
+	}
+}
+
+func formatField(value any) string {
+	switch v := value.(type) {
+	case time.Time:
+		return formatTime(v)
+	case float64:
+		return fmt.Sprintf("%.2f", v)
+	case *int:
+		if v == nil {
+			return ""
+		}
+		return fmt.Sprint(*v)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,84 @@
+package herfish
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// fixtureEpoch is the timestamp of the first generated commit. Fixed
+// timestamps and contents make generated repositories byte-for-byte
+// reproducible, so commit hashes match across runs and machines.
+var fixtureEpoch = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+type genFixturesCommand struct {
+	Commits    int `long:"commits" default:"3" description:"Number of commits in each repository"`
+	DirtyEvery int `long:"dirty-every" description:"Leave every Nth repository with an uncommitted change"`
+	Args       struct {
+		Dir   string `positional-arg-name:"DIR" description:"Directory to create the repositories in"`
+		Count int    `positional-arg-name:"N" description:"Number of repositories to create"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *genFixturesCommand) Execute(_ []string) error {
+	if c.Args.Count < 0 || c.Commits < 0 {
+		return fmt.Errorf("repository and commit counts must not be negative")
+	}
+
+	for i := range c.Args.Count {
+		dir := filepath.Join(c.Args.Dir, fmt.Sprintf("repo-%04d", i))
+		dirty := c.DirtyEvery > 0 && i%c.DirtyEvery == 0
+		if err := genFixture(dir, c.Commits, dirty); err != nil {
+			return fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+		slog.Debug("created fixture", "dir", dir, "commits", c.Commits, "dirty", dirty)
+	}
+
+	slog.Info("created fixtures", "dir", c.Args.Dir, "count", c.Args.Count)
+	return nil
+}
+
+func genFixture(dir string, commits int, dirty bool) error {
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		return fmt.Errorf("failed to init repo: %w", err)
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	file := filepath.Join(dir, "README")
+	for n := range commits {
+		if err := os.WriteFile(file, fmt.Appendf(nil, "commit %d\n", n), 0o644); err != nil {
+			return err
+		}
+		if _, err := wt.Add("README"); err != nil {
+			return fmt.Errorf("failed to stage file: %w", err)
+		}
+
+		sig := &object.Signature{
+			Name:  "herfish",
+			Email: "herfish@example.com",
+			When:  fixtureEpoch.Add(time.Duration(n) * time.Hour),
+		}
+		_, err := wt.Commit(fmt.Sprintf("commit %d", n), &git.CommitOptions{Author: sig, Committer: sig})
+		if err != nil {
+			return fmt.Errorf("failed to commit: %w", err)
+		}
+	}
+
+	// Untracked files do not make a repository dirty, so modify the tracked
+	// file instead; without commits there is nothing tracked to modify.
+	if dirty {
+		return os.WriteFile(file, []byte("uncommitted change\n"), 0o644)
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package herfish
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// perWorktreeFiles live in a linked worktree's own gitdir; everything else,
+// such as objects and logs/refs, lives in the common dir it shares with the
+// main checkout.
+var perWorktreeFiles = map[string]bool{
+	"HEAD":       true,
+	"ORIG_HEAD":  true,
+	"FETCH_HEAD": true,
+	"index":      true,
+	"logs/HEAD":  true,
+}
+
+// gitPath returns the path of name (slash separated, e.g. "logs/refs/stash")
+// inside the repo at dir. It follows a .git file to the real gitdir, as in
+// linked worktrees and submodule checkouts, and its commondir link for
+// files the worktree shares with the main checkout.
+func gitPath(dir, name string) string {
+	gitDir := resolveGitDir(dir)
+	if !perWorktreeFiles[name] {
+		gitDir = readGitLink(gitDir, "commondir", gitDir)
+	}
+	return filepath.Join(gitDir, filepath.FromSlash(name))
+}
+
+// resolveGitDir returns dir/.git, or the gitdir it points to when it is a
+// "gitdir: <path>" file.
+func resolveGitDir(dir string) string {
+	dotGit := filepath.Join(dir, ".git")
+	info, err := os.Stat(dotGit)
+	if err != nil || info.IsDir() {
+		return dotGit
+	}
+
+	b, err := os.ReadFile(dotGit)
+	if err != nil {
+		return dotGit
+	}
+	target, ok := strings.CutPrefix(strings.TrimSpace(string(b)), "gitdir:")
+	if !ok {
+		return dotGit
+	}
+	return resolveRelative(dir, strings.TrimSpace(target))
+}
+
+// readGitLink reads a file in gitDir holding a path relative to gitDir, like
+// commondir, returning fallback when it is absent.
+func readGitLink(gitDir, name, fallback string) string {
+	b, err := os.ReadFile(filepath.Join(gitDir, name))
+	if err != nil {
+		return fallback
+	}
+	return resolveRelative(gitDir, strings.TrimSpace(string(b)))
+}
+
+func resolveRelative(base, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(base, path)
+}
@@ -0,0 +1,44 @@
+package herfish
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGitPath(t *testing.T) {
+	root := t.TempDir()
+	main := filepath.Join(root, "main")
+	wtGitDir := filepath.Join(main, ".git", "worktrees", "wt")
+	linked := filepath.Join(root, "wt")
+	for _, dir := range []string{wtGitDir, linked} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(linked, ".git"), "gitdir: "+wtGitDir+"\n")
+	write(filepath.Join(wtGitDir, "commondir"), "../..\n")
+
+	mainGitDir := filepath.Join(main, ".git")
+	tests := []struct {
+		dir, name, want string
+	}{
+		{dir: main, name: "objects", want: filepath.Join(mainGitDir, "objects")},
+		{dir: main, name: "logs/HEAD", want: filepath.Join(mainGitDir, "logs", "HEAD")},
+		{dir: linked, name: "logs/HEAD", want: filepath.Join(wtGitDir, "logs", "HEAD")},
+		{dir: linked, name: "FETCH_HEAD", want: filepath.Join(wtGitDir, "FETCH_HEAD")},
+		{dir: linked, name: "logs/refs/stash", want: filepath.Join(mainGitDir, "logs", "refs", "stash")},
+		{dir: linked, name: "objects", want: filepath.Join(mainGitDir, "objects")},
+	}
+
+	for _, tt := range tests {
+		if got := gitPath(tt.dir, tt.name); got != tt.want {
+			t.Errorf("gitPath(%q, %q) = %q, want %q", tt.dir, tt.name, got, tt.want)
+		}
+	}
+}
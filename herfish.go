@@ -1,45 +1,216 @@
 package herfish
 
 import (
-	"bufio"
 	"bytes"
-	"context"
 	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strings"
+	"sync"
 	"text/template"
 	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/jessevdk/go-flags"
 )
 
 var opts struct {
-	LogFormat      string `long:"log-format" choice:"text" choice:"json" default:"text" description:"Log format"`
-	Verbose        []bool `short:"v" long:"verbose" description:"Show verbose debug information, each -v bumps log level"`
-	logLevel       slog.Level
-	Sentinel       string `short:"s" long:"sentinel" default:".git" description:"Sentinel folder to stop searching"`
-	CommitCountMax int    `default:"-1" short:"m" long:"commit-count-max" description:"Filter repositories with commits less than or equal to the specified count"`
+	LogFormat               string `long:"log-format" choice:"text" choice:"json" default:"text" description:"Log format"`
+	Verbose                 []bool `short:"v" long:"verbose" description:"Show verbose debug information, each -v bumps log level"`
+	logLevel                slog.Level
+	DumpConfig              bool   `long:"dump-config" description:"Print the effective configuration to stderr after applying flags and defaults"`
+	Sentinel                string `short:"s" long:"sentinel" default:".git" env:"HERFISH_SENTINEL" description:"Sentinel folder to stop searching"`
+	SentinelGlob            string `long:"sentinel-glob" description:"Glob pattern matched against directory entries instead of an exact sentinel name"`
+	SentinelCI              bool   `long:"sentinel-ci" description:"Match the sentinel name case-insensitively"`
+	PerLineSentinel         bool   `long:"per-line-sentinel" description:"Read input lines as path<TAB>sentinel; lines without a sentinel use the global one"`
+	ShowSentinel            bool   `long:"show-sentinel" description:"Append the sentinel name that matched to each output line, e.g. /path [.git]"`
+	SentinelDepth           int    `long:"sentinel-depth" default:"-1" description:"Instead of walking up, only report sentinel dirs exactly this many levels below each input path (0 is the path itself, 1 is input/*)"`
+	CommitCountMax          int    `default:"-1" short:"m" long:"commit-count-max" description:"Filter repositories with commits less than or equal to the specified count"`
+	Percentile              bool   `long:"percentile" description:"Rank each repository's commit count against all analyzed repositories as .Percentile"`
+	Baseline                string `long:"baseline" description:"Report commits added since a previous --output json file as .CommitDelta"`
+	baseline                map[string]int
+	MarkOverMax             bool   `long:"mark-over-max" description:"Keep repositories over --commit-count-max and mark them instead of filtering"`
+	CommitCountEq           int    `default:"-1" long:"commit-count-eq" description:"Filter repositories with exactly the specified number of commits"`
+	TagCountMin             int    `default:"-1" long:"tag-count-min" description:"Filter repositories with at least the specified number of tags"`
+	TagCountMax             int    `default:"-1" long:"tag-count-max" description:"Filter repositories with at most the specified number of tags"`
+	ByAuthor                bool   `long:"by-author" description:"Break down the commit count on HEAD by author email as .Authors"`
+	ByAuthorMax             int    `long:"by-author-max" default:"10" description:"Keep only the authors with the most commits for --by-author; 0 keeps all"`
+	SubjectWidth            int    `long:"subject-width" default:"72" description:"Truncate .HeadSubject to this many characters; 0 disables truncation"`
+	SinceTag                bool   `long:"since-tag" description:"Count commits on HEAD since the most recent reachable tag as .CommitsSinceTag (-1 without tags)"`
+	TagsContainingHead      bool   `long:"tags-containing-head" description:"List tags that contain HEAD, like git tag --contains HEAD (walks history once per tag)"`
+	TagsContainingHeadMax   int    `long:"tags-containing-head-max" default:"10" description:"List at most this many tags for --tags-containing-head; 0 lists all"`
+	MinTracked              int    `default:"-1" long:"min-tracked" description:"Filter repositories with at least this many tracked files"`
+	MaxTracked              int    `default:"-1" long:"max-tracked" description:"Filter repositories with at most this many tracked files"`
+	AllBranches             bool   `long:"all-branches" description:"Count commits reachable from any local branch; the HEAD-only count is kept as .CurrentBranchCommits"`
+	FirstParent             bool   `long:"first-parent" description:"Count only commits reachable through first parents, like git log --first-parent"`
+	NoStatus                bool   `long:"no-status" description:"Skip clean/dirty status checks when counting commits"`
+	FastStatus              bool   `long:"fast-status" description:"Treat a repository as clean when tracked files match the index size and mtime, falling back to full status otherwise; may rarely report a modified repository as clean"`
+	ExcludeCleanEmpty       bool   `long:"exclude-clean-empty" description:"Hide repositories that have no commits and a clean worktree"`
+	EmptyOnly               bool   `long:"empty-only" description:"Keep only repositories that have no commits"`
+	SkipShallow             bool   `long:"skip-shallow" description:"Drop shallow clones, whose commit counts cover only the fetched depth"`
+	Age                     bool   `long:"age" description:"Find each repository's first commit time by walking to the root commit"`
+	FetchOlderThan          string `long:"fetch-older-than" description:"Keep repositories not fetched within this duration (e.g. 36h, 3d, 2w)"`
+	fetchOlderThan          time.Duration
+	NewerThan               string `long:"newer-than" description:"Keep repositories whose last commit is within this duration (e.g. 12h, 3d, 2w)"`
+	newerThan               time.Duration
+	ActiveSince             string `long:"active-since" description:"Keep repositories whose HEAD reflog has an entry within this duration (e.g. 12h, 3d); repositories without a reflog are dropped"`
+	activeSince             time.Duration
+	StaleStashOlderThan     string `long:"stale-stash-older-than" description:"Keep repositories whose oldest stash is older than this duration (e.g. 30d, 8w)"`
+	staleStashOlderThan     time.Duration
+	Sort                    string  `long:"sort" choice:"path" choice:"commits" choice:"status" choice:"last-commit" choice:"score" choice:"dirty-first" default:"path" description:"Sort results by key; last-commit sorts newest first, score highest first, and dirty-first puts dirty before clean before anything else; ties are broken by path"`
+	ScoreDirtyWeight        float64 `long:"score-dirty-weight" default:"10" description:"Score added when the worktree is dirty"`
+	ScoreAheadWeight        float64 `long:"score-ahead-weight" default:"2" description:"Score added per commit ahead of upstream"`
+	ScoreBehindWeight       float64 `long:"score-behind-weight" default:"1" description:"Score added per commit behind upstream"`
+	ScoreAgeWeight          float64 `long:"score-age-weight" default:"0.1" description:"Score added per day since the last commit"`
+	Recent                  bool    `long:"recent" description:"Sort by last commit time, newest first (shorthand for --sort last-commit)"`
+	DirtyFirst              bool    `long:"dirty-first" description:"Sort dirty repositories first, then clean, then the rest (shorthand for --sort dirty-first)"`
+	EveryNth                int     `long:"every-nth" description:"Keep every Nth repository after sorting, starting with the first"`
+	RequireResults          bool    `long:"require-results" description:"Exit with status 4 when no repositories remain after filtering"`
+	MaxResults              int     `long:"max-results" description:"Limit output to this many repositories after sorting and sampling"`
+	Output                  string  `long:"output" choice:"text" choice:"table" choice:"json" choice:"jsonl" choice:"json-report" default:"text" description:"Output format"`
+	outputSet               bool
+	OutputFile              string `long:"output-file" description:"Write results to this file; the format is inferred from its extension unless --output is given"`
+	JSONCompactStream       bool   `long:"json-compact-stream" description:"Stream results as a compact JSON array while scanning; sorting, sampling and --dedupe-by-origin are not applied"`
+	Pretty                  bool   `long:"pretty" description:"Indent JSON, JSONL and json-report output"`
+	Pull                    bool   `long:"pull" description:"Fast-forward every clean matched repository that has an upstream (requires --yes)"`
+	Checkout                string `long:"checkout" description:"Check out this branch in every clean matched repository (requires --yes)"`
+	Yes                     bool   `long:"yes" description:"Confirm actions that modify repositories"`
+	Exec                    string `long:"exec" description:"Run a shell command in each repository; {} is replaced with the repository path"`
+	PathsOnly               bool   `long:"paths-only" description:"Print only repository paths, overriding output format and template"`
+	Print0                  bool   `long:"print0" description:"Print repository paths separated by NUL for xargs -0"`
+	Print0KeepFailed        bool   `long:"print0-keep-failed" description:"With --print0, also print repositories whose analysis failed"`
+	ShowTimes               bool   `long:"show-times" description:"Show each repository's last commit and last fetch times in text output"`
+	RelativeTime            bool   `long:"relative-time" description:"Show last commit and last fetch times in text output as relative durations like \"3 days ago\""`
+	Anchor                  string `long:"anchor" description:"Show repository paths relative to this directory instead of as given"`
+	TrimPrefix              string `long:"trim-prefix" description:"Strip this prefix from displayed repository paths"`
+	Fzf                     bool   `long:"fzf" description:"Print the path, a tab and a status preview for fzf pickers"`
+	StripANSI               bool   `long:"strip-ansi" description:"Remove ANSI escape sequences from output; --output-file output is always stripped"`
+	Fields                  string `long:"fields" description:"Print these comma-separated fields, named as in JSON output (e.g. dir,repo_status,commit_count)"`
+	fields                  []string
+	Separator               string   `long:"separator" default:"\n" description:"Text placed between template or --paths-only records"`
+	NoTrailingNewline       bool     `long:"no-trailing-newline" description:"Omit the newline after the last template or --paths-only record"`
+	FieldSeparator          string   `long:"field-separator" default:" " description:"Separator placed between --fields columns"`
+	Template                string   `long:"template" description:"Go template used to render each repository"`
+	ReportTemplate          string   `long:"report-template" description:"Go template executed once over all results, with .Repos, .Total, .DirtyCount, .CleanCount and .ScannedAt"`
+	WorktreeSize            bool     `long:"worktree-size" description:"Measure working tree disk usage excluding .git (walks every file)"`
+	CountObjects            bool     `long:"count-objects" description:"Count loose objects and pack files in each repository"`
+	NeedsGC                 bool     `long:"needs-gc" description:"Keep only repositories with enough loose objects or packs to warrant git gc"`
+	IncludeIgnored          bool     `long:"include-ignored" description:"Count files matched by gitignore rules in each worktree"`
+	OnlyWithChangesOnBranch bool     `long:"only-with-changes-on-branch" description:"Keep only repositories whose current branch has commits not on the default branch (same repos as --has-unmerged-only, but cheaper)"`
+	HasUnmergedOnly         bool     `long:"has-unmerged-only" description:"Keep only repositories whose HEAD has commits since its merge base with the default branch (same repos as --only-with-changes-on-branch, but also counts them)"`
+	OffDefaultOnly          bool     `long:"off-default-only" description:"Keep only repositories not on their default branch, including detached HEADs"`
+	HasNotesOnly            bool     `long:"has-notes-only" description:"Keep only repositories with git notes (refs/notes/commits)"`
+	SubmoduleRepos          string   `long:"submodule-repos" choice:"true" choice:"false" default:"true" description:"Whether a directory whose .git is a gitlink file (a submodule checkout) counts as a repository; when false the search continues upward"`
+	MainReposOnly           bool     `long:"main-repos-only" description:"Only report repositories with a .git directory; inputs whose nearest .git is a file (linked worktrees, submodule checkouts) are dropped"`
+	SkipSubmodules          bool     `long:"skip-submodules" description:"Drop repositories nested inside another repository's tree"`
+	NoOriginOnly            bool     `long:"no-origin-only" description:"Keep only repositories without an origin remote"`
+	ExcludeOrigin           []string `long:"exclude-origin" description:"Drop repositories whose origin URL matches this regex (repeatable)"`
+	excludeOrigin           []*regexp.Regexp
+	WrongEmail              string `long:"wrong-email" description:"Keep only repositories whose effective user.email does not match this regex"`
+	wrongEmail              *regexp.Regexp
+	DedupeByOrigin          bool   `long:"dedupe-by-origin" description:"Keep only the first repository for each origin URL"`
+	Manifest                string `long:"manifest" description:"Read additional repository paths from a file of path<TAB>label lines; labels are exposed as .Label"`
+	InputSource             string `long:"input-source" choice:"stdin" choice:"args" choice:"both" default:"both" description:"Where to read paths from; both merges arguments and stdin"`
+	MaxInput                int    `long:"max-input" default:"0" description:"Stop reading input after this many paths and warn; 0 means no limit"`
+	InputFormat             string `long:"input-format" choice:"lines" choice:"json" default:"lines" description:"Format of paths read from stdin"`
+	NoWaitMessage           bool   `long:"no-wait-message" description:"Do not print the Waiting for stdin... prompt; other messages are unaffected"`
+	Validate                bool   `long:"validate" description:"Drop sentinel dirs that git cannot open as a repository, such as leftover .git junk"`
+	SkipRemoteFS            bool   `long:"skip-remote-fs" description:"Skip repositories on network filesystems (best effort, Linux only)"`
+	GlobInput               bool   `long:"glob-input" description:"Expand input paths as glob patterns (with ~ for the home directory) before scanning"`
+	FollowSymlinks          bool   `long:"follow-symlinks" description:"Resolve symlinks in input paths so results report canonical paths"`
+	Watch                   string `long:"watch" description:"Rescan and reprint every interval (e.g. 30s, 5m) until interrupted"`
+	watch                   time.Duration
+	Deadline                string `long:"deadline" description:"Stop analyzing new repositories after this overall duration and exit with code 3"`
+	deadlineAt              time.Time
+	SlowThreshold           string `long:"slow-threshold" description:"Warn about repositories whose commit count or status check takes longer than this (e.g. 500ms, 2s)"`
+	slowThreshold           time.Duration
+	Concurrency             int `long:"concurrency" default:"1" description:"Number of repositories to analyze in parallel"`
+	DiscoveryConcurrency    int `long:"discovery-concurrency" default:"1" description:"Number of input paths to search for sentinel dirs in parallel"`
+	Retries                 int `long:"retries" default:"0" description:"Retry transient repo open and status failures up to this many times with exponential backoff"`
 }
 
-const outputTemplate = `{{if .CountCommits}}{{printf "%4d %s " .CommitCount .RepoStatus}}{{end}}{{.Dir}}
+// fzfTemplate puts the path first so fzf can select on the first field and
+// preview the rest.
+const fzfTemplate = "{{.Dir}}\t{{.RepoStatus}} {{.CommitCount}}\n"
+
+const outputTemplate = `{{if .CountCommits}}{{printf "%4d %s " .CommitCount .RepoStatus}}{{end}}{{if baseline}}{{printf "%+d " .CommitDelta}}{{end}}{{if .Percentile}}{{printf "p%.0f " .Percentile}}{{end}}{{if showTimes}}committed {{fmtTime .LastCommitTime}}, fetched {{fmtTime .LastFetchTime}} {{end}}{{.Dir}}{{if .Sentinel}} [{{.Sentinel}}]{{end}}{{if .Shallow}} (shallow){{end}}{{if .OverMax}} (over max){{end}}
 `
 
-var ErrNoGitLog = errors.New("failed to query git logs")
+var (
+	ErrNoGitLog    = errors.New("failed to query git logs")
+	ErrCorruptHead = errors.New("HEAD does not resolve to a readable commit")
+	ErrNoResults   = errors.New("no repositories matched")
+)
+
+// exitNoResults is returned by Execute when --require-results is set and
+// nothing matched.
+const exitNoResults = 4
 
 type templateData struct {
-	Dir          string
-	CountCommits bool
-	CommitCount  int
-	RepoStatus   string
+	Dir                   string         `json:"dir"`
+	RepoName              string         `json:"repo_name"`
+	AbsDir                string         `json:"abs_dir"`
+	RelDir                string         `json:"rel_dir"`
+	Label                 string         `json:"label,omitempty"`
+	Sentinel              string         `json:"sentinel,omitempty"`
+	CountCommits          bool           `json:"-"`
+	CommitCount           int            `json:"commit_count"`
+	CurrentBranchCommits  int            `json:"current_branch_commits,omitempty"`
+	CommitDelta           int            `json:"commit_delta,omitempty"`
+	Authors               map[string]int `json:"authors,omitempty"`
+	Percentile            float64        `json:"percentile,omitempty"`
+	RepoStatus            string         `json:"repo_status"`
+	Empty                 bool           `json:"empty,omitempty"`
+	Shallow               bool           `json:"shallow,omitempty"`
+	Ahead                 int            `json:"ahead,omitempty"`
+	Behind                int            `json:"behind,omitempty"`
+	Score                 float64        `json:"score,omitempty"`
+	LastFetchTime         time.Time      `json:"last_fetch_time,omitzero"`
+	FirstCommitTime       time.Time      `json:"first_commit_time,omitzero"`
+	LastCommitTime        time.Time      `json:"last_commit_time,omitzero"`
+	HeadSubject           string         `json:"head_subject,omitempty"`
+	LastActivityTime      time.Time      `json:"last_activity_time,omitzero"`
+	TagCount              int            `json:"tag_count,omitempty"`
+	TagsContainingHead    []string       `json:"tags_containing_head,omitempty"`
+	CommitsSinceTag       *int           `json:"commits_since_tag,omitempty"`
+	StashCount            int            `json:"stash_count,omitempty"`
+	OldestStashAge        time.Duration  `json:"oldest_stash_age_ns,omitempty"`
+	Submodule             bool           `json:"submodule,omitempty"`
+	HasNotes              bool           `json:"has_notes,omitempty"`
+	HasBranchChanges      bool           `json:"has_branch_changes,omitempty"`
+	CommitsAheadOfDefault int            `json:"commits_ahead_of_default,omitempty"`
+	TrackedFileCount      int            `json:"tracked_file_count,omitempty"`
+	LooseObjects          int            `json:"loose_objects,omitempty"`
+	PackFiles             int            `json:"pack_files,omitempty"`
+	NeedsGC               bool           `json:"needs_gc,omitempty"`
+	Origin                string         `json:"origin,omitempty"`
+	FetchURL              string         `json:"fetch_url,omitempty"`
+	PushURL               string         `json:"push_url,omitempty"`
+	Branch                string         `json:"branch,omitempty"`
+	DefaultBranch         string         `json:"default_branch,omitempty"`
+	TrackingRemote        string         `json:"tracking_remote,omitempty"`
+	UserName              string         `json:"user_name,omitempty"`
+	UserEmail             string         `json:"user_email,omitempty"`
+	WorktreeSizeBytes     int64          `json:"worktree_size_bytes,omitempty"`
+	IgnoredFiles          int            `json:"ignored_files,omitempty"`
+	StatusPorcelain       string         `json:"status_porcelain,omitempty"`
+	OverMax               bool           `json:"over_max,omitempty"`
 }
 
 func Execute() int {
-	if err := parseFlags(); err != nil {
+	args, command, err := parseFlags()
+	if err != nil {
+		return 1
+	}
+
+	if err := resolveOptions(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		return 1
 	}
 
@@ -51,7 +222,25 @@ func Execute() int {
 		return 1
 	}
 
-	if err := run(); err != nil {
+	logConfig()
+
+	if command != nil {
+		if err := command.Execute(args); err != nil {
+			slog.Error("command failed", "error", err)
+			return 1
+		}
+		return 0
+	}
+
+	if err := run(args); err != nil {
+		if errors.Is(err, ErrDeadlineExceeded) {
+			slog.Warn("partial results", "error", err)
+			return exitPartial
+		}
+		if errors.Is(err, ErrNoResults) {
+			slog.Warn("empty result", "error", err)
+			return exitNoResults
+		}
 		slog.Error("run failed", "error", err)
 		return 1
 	}
@@ -59,31 +248,106 @@ func Execute() int {
 	return 0
 }
 
-func parseFlags() error {
-	_, err := flags.Parse(&opts)
-	return err
+// parseFlags parses the command line. When a subcommand was given it is
+// returned instead of being run, so it executes after logging is set up.
+func parseFlags() ([]string, flags.Commander, error) {
+	parser := flags.NewParser(&opts, flags.Default)
+	parser.SubcommandsOptional = true
+
+	_, err := parser.AddCommand("gen-fixtures", "Create N small git repositories under DIR",
+		"Create N small, deterministic git repositories under DIR for benchmarking and reproducing scanner issues.",
+		&genFixturesCommand{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var command flags.Commander
+	parser.CommandHandler = func(cmd flags.Commander, _ []string) error {
+		command = cmd
+		return nil
+	}
+
+	args, err := parser.Parse()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	output := parser.FindOptionByLongName("output")
+	opts.outputSet = output.IsSet() && !output.IsSetDefault()
+
+	return args, command, nil
 }
 
-func run() error {
-	fmt.Fprintln(os.Stderr, "Waiting for stdin...")
-	scanner := bufio.NewScanner(os.Stdin)
-	var paths []string
+func run(args []string) error {
+	paths, err := collectPaths(args, opts.InputSource)
+	if err != nil {
+		return err
+	}
 
-	for scanner.Scan() {
-		paths = append(paths, scanner.Text())
+	var manifest []manifestEntry
+	if opts.Manifest != "" {
+		manifest, err = readManifest(opts.Manifest)
+		if err != nil {
+			return err
+		}
+		for _, entry := range manifest {
+			paths = append(paths, entry.path)
+		}
+	}
+
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "no input paths provided; pass paths as arguments or on stdin")
+		return scanError(0, 0)
 	}
 
-	if err := scanner.Err(); err != nil {
-		fmt.Fprintln(os.Stderr, "Error reading input:", err)
-		os.Exit(1)
+	lineSentinels := make(map[string]string)
+	if opts.PerLineSentinel {
+		paths = splitLineSentinels(paths, lineSentinels)
+	}
+
+	if opts.GlobInput {
+		paths, err = expandGlobs(paths, lineSentinels)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.FollowSymlinks {
+		resolved, err := resolveSymlinks(paths)
+		if err != nil {
+			return fmt.Errorf("failed to resolve symlinks: %w", err)
+		}
+		for i, path := range paths {
+			if sentinel, ok := lineSentinels[path]; ok {
+				lineSentinels[resolved[i]] = sentinel
+			}
+		}
+		paths = resolved
 	}
 
 	sort.Strings(paths)
 
 	slog.Debug("paths", "paths", paths)
 
+	if opts.Watch != "" {
+		return watch(paths, manifest, lineSentinels, opts.watch)
+	}
+
+	return scan(paths, manifest, lineSentinels)
+}
+
+// scan finds the repos for paths, analyzes and filters them, and writes the
+// results.
+func scan(paths []string, manifest []manifestEntry, lineSentinels map[string]string) error {
+	start := time.Now()
 	var dataCollection []templateData
-	sentinelDirs, err := findSentinelDirs(paths, opts.Sentinel)
+	var scanErrors []repoError
+	matchers, err := newSentinelMatchers(lineSentinels)
+	if err != nil {
+		return err
+	}
+
+	sentinelDirs, sentinelNames, err := findSentinelDirs(paths, matchers, opts.SentinelDepth, opts.DiscoveryConcurrency)
 	if err != nil {
 		return fmt.Errorf("failed to find sentinel dirs: %w", err)
 	}
@@ -92,103 +356,563 @@ func run() error {
 		slog.Debug("found sentinel dir", "dir", dir)
 	}
 
-	for _, dir := range sentinelDirs {
-		data := templateData{
-			Dir:          dir,
-			CountCommits: opts.CommitCountMax != -1,
-			RepoStatus:   "unknown",
-		}
-
-		if opts.CommitCountMax != -1 {
-			slog.Debug("counting commits", "dir", dir)
-			commitCount, err := countCommits(dir)
-			if err == ErrNoGitLog {
-				slog.Error("no log found", "dir", dir)
-			} else if err != nil {
-				return fmt.Errorf("failed to count commits: %w", err)
-			} else {
-				data.CommitCount = commitCount
-				slog.Debug("counted commits", "dir", dir, "count", commitCount)
-				status, err := getRepoStatus(dir)
-				if err != nil {
-					// print error to stedrr but continue
-					fmt.Fprintln(os.Stderr, fmt.Errorf("failed to get repo status for %s: %w", dir, err))
+	sentinelDirs = skipIgnored(sentinelDirs)
+
+	if opts.SkipRemoteFS {
+		sentinelDirs = skipRemoteFS(sentinelDirs)
+	}
+
+	if opts.Validate {
+		sentinelDirs = skipInvalidRepos(sentinelDirs)
+	}
+
+	if opts.JSONCompactStream {
+		return streamJSON(len(paths), sentinelDirs, sentinelNames, manifest, start)
+	}
+
+	results := processRepos(sentinelDirs, opts.Concurrency)
+	skipped := 0
+	for _, result := range results {
+		if result.skipped {
+			skipped++
+			continue
+		}
+		scanErrors = append(scanErrors, result.errs...)
+		annotateResult(&result.data, manifest, sentinelNames)
+		dataCollection = append(dataCollection, result.data)
+	}
+
+	// Percentiles are ranked over every analyzed repo, before filtering.
+	if opts.Percentile {
+		assignPercentiles(dataCollection)
+	}
+
+	filteredData := applyFilters(dataCollection)
+
+	if opts.DedupeByOrigin {
+		filteredData = dedupeByOrigin(filteredData)
+	}
+
+	sortKey := opts.Sort
+	if opts.Recent {
+		sortKey = "last-commit"
+	}
+	if opts.DirtyFirst {
+		sortKey = "dirty-first"
+	}
+	sortResults(filteredData, sortKey)
+
+	// Sampling and limiting run after sorting so they are deterministic.
+	if opts.EveryNth > 1 {
+		filteredData = everyNth(filteredData, opts.EveryNth)
+	}
+
+	if opts.MaxResults > 0 && len(filteredData) > opts.MaxResults {
+		filteredData = filteredData[:opts.MaxResults]
+	}
+
+	if opts.Pull {
+		if !opts.Yes {
+			return ErrNotConfirmed
+		}
+		if err := pullRepos(filteredData); err != nil {
+			return err
+		}
+		logErrorSummary(scanErrors)
+		logScanStats(len(paths), len(sentinelDirs), len(dataCollection)-len(filteredData), len(scanErrors), start)
+		return scanError(skipped, len(filteredData))
+	}
+
+	if opts.Checkout != "" {
+		if !opts.Yes {
+			return ErrNotConfirmed
+		}
+		if err := checkoutRepos(filteredData, opts.Checkout); err != nil {
+			return err
+		}
+		logErrorSummary(scanErrors)
+		logScanStats(len(paths), len(sentinelDirs), len(dataCollection)-len(filteredData), len(scanErrors), start)
+		return scanError(skipped, len(filteredData))
+	}
+
+	if opts.Exec != "" {
+		if err := execInRepos(filteredData, opts.Exec, opts.Concurrency); err != nil {
+			return err
+		}
+		logErrorSummary(scanErrors)
+		logScanStats(len(paths), len(sentinelDirs), len(dataCollection)-len(filteredData), len(scanErrors), start)
+		return scanError(skipped, len(filteredData))
+	}
+
+	for i := range filteredData {
+		filteredData[i].Dir = displayDir(filteredData[i])
+	}
+
+	outputResults(filteredData, scanErrors)
+
+	logErrorSummary(scanErrors)
+	logScanStats(len(paths), len(sentinelDirs), len(dataCollection)-len(filteredData), len(scanErrors), start)
+
+	return scanError(skipped, len(filteredData))
+}
+
+// scanError reports a deadline cut-off first, then an empty result when
+// --require-results is set.
+func scanError(skipped, resultCount int) error {
+	if err := deadlineError(skipped); err != nil {
+		return err
+	}
+	if opts.RequireResults && resultCount == 0 {
+		return ErrNoResults
+	}
+	return nil
+}
+
+// annotateResult fills fields that come from scan inputs rather than from
+// the repository itself.
+func annotateResult(data *templateData, manifest []manifestEntry, sentinelNames map[string]string) {
+	data.Label = manifestLabel(manifest, data.Dir)
+	if showSentinelEnabled() {
+		data.Sentinel = sentinelNames[data.Dir]
+	}
+	if opts.baseline != nil {
+		data.CommitDelta = commitDelta(*data)
+	}
+}
+
+func logScanStats(pathCount, sentinelCount, filteredOut, errorCount int, start time.Time) {
+	slog.Info("scan complete",
+		"paths", pathCount,
+		"sentinelDirs", sentinelCount,
+		"filteredOut", filteredOut,
+		"errors", errorCount,
+		"elapsed", time.Since(start),
+	)
+}
+
+type repoResult struct {
+	data    templateData
+	errs    []repoError
+	skipped bool
+}
+
+// processRepos analyzes dirs using up to concurrency workers. Results are
+// stored by index so output order matches dirs regardless of scheduling.
+func processRepos(dirs []string, concurrency int) []repoResult {
+	results := make([]repoResult, len(dirs))
+	jobs := make(chan int)
+
+	progress := startSpinner(len(dirs))
+	defer progress.stop()
+
+	var wg sync.WaitGroup
+	for range max(concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if deadlineExceeded() {
+					results[i].skipped = true
+					continue
 				}
-				data.RepoStatus = status
+				results[i] = analyzeRepo(dirs[i])
+				progress.increment()
+			}
+		}()
+	}
+
+	for i := range dirs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+func analyzeRepo(dir string) repoResult {
+	var result repoResult
+	result.data = templateData{
+		Dir:          dir,
+		RepoName:     filepath.Base(dir),
+		CountCommits: countingEnabled(),
+		RepoStatus:   "unknown",
+	}
+
+	result.data.AbsDir, result.data.RelDir = absAndRelDir(dir)
+	result.data.LastFetchTime = lastFetchTime(dir)
+
+	if originEnabled() {
+		origin, err := getOrigin(dir)
+		if err != nil {
+			result.errs = append(result.errs, newRepoError(dir, err))
+		}
+		result.data.Origin = origin
+	}
+
+	if branchEnabled() {
+		branch, defaultBranch, err := currentAndDefaultBranch(dir)
+		if err != nil {
+			result.errs = append(result.errs, newRepoError(dir, err))
+		}
+		result.data.Branch, result.data.DefaultBranch = branch, defaultBranch
+	}
+
+	if trackingRemoteEnabled() {
+		remote, err := trackingRemote(dir)
+		if err != nil {
+			result.errs = append(result.errs, newRepoError(dir, err))
+		}
+		result.data.TrackingRemote = remote
+	}
+
+	if identityEnabled() {
+		name, email, err := userIdentity(dir)
+		if err != nil {
+			result.errs = append(result.errs, newRepoError(dir, err))
+		}
+		result.data.UserName, result.data.UserEmail = name, email
+	}
+
+	if remoteURLsEnabled() {
+		fetchURL, pushURL, err := originURLs(dir)
+		if err != nil {
+			result.errs = append(result.errs, newRepoError(dir, err))
+		}
+		result.data.FetchURL, result.data.PushURL = fetchURL, pushURL
+	}
+
+	if opts.WorktreeSize {
+		size, err := worktreeSize(dir)
+		if err != nil {
+			result.errs = append(result.errs, newRepoError(dir, fmt.Errorf("failed to measure worktree: %w", err)))
+		}
+		result.data.WorktreeSizeBytes = size
+	}
+
+	if opts.IncludeIgnored {
+		count, err := countIgnoredFiles(dir)
+		if err != nil {
+			result.errs = append(result.errs, newRepoError(dir, fmt.Errorf("failed to count ignored files: %w", err)))
+		}
+		result.data.IgnoredFiles = count
+	}
+
+	if firstCommitEnabled() {
+		first, err := firstCommitTime(dir)
+		if err != nil {
+			result.errs = append(result.errs, newRepoError(dir, err))
+		}
+		result.data.FirstCommitTime = first
+	}
+
+	if submoduleEnabled() {
+		result.data.Submodule = isSubmodule(dir)
+	}
+
+	if trackedCountEnabled() {
+		count, err := countTrackedFiles(dir)
+		if err != nil {
+			result.errs = append(result.errs, newRepoError(dir, err))
+		}
+		result.data.TrackedFileCount = count
+	}
+
+	if countObjectsEnabled() {
+		loose, packs, err := countObjects(dir)
+		if err != nil {
+			result.errs = append(result.errs, newRepoError(dir, fmt.Errorf("failed to count objects: %w", err)))
+		}
+		result.data.LooseObjects = loose
+		result.data.PackFiles = packs
+		result.data.NeedsGC = needsGC(loose, packs)
+	}
+
+	if notesEnabled() {
+		notes, err := hasNotes(dir)
+		if err != nil {
+			result.errs = append(result.errs, newRepoError(dir, err))
+		}
+		result.data.HasNotes = notes
+	}
+
+	if lastCommitEnabled() {
+		last, err := lastCommitTime(dir)
+		if err != nil {
+			result.errs = append(result.errs, newRepoError(dir, err))
+		}
+		result.data.LastCommitTime = last
+	}
+
+	if templateReferences("HeadSubject") {
+		subject, err := headSubject(dir, opts.SubjectWidth)
+		if err != nil {
+			result.errs = append(result.errs, newRepoError(dir, err))
+		}
+		result.data.HeadSubject = subject
+	}
+
+	if activityEnabled() {
+		last, err := lastActivityTime(dir)
+		if err != nil {
+			result.errs = append(result.errs, newRepoError(dir, err))
+		}
+		result.data.LastActivityTime = last
+	}
+
+	if stashEnabled() {
+		count, age, err := stashInfo(dir, time.Now())
+		if err != nil {
+			result.errs = append(result.errs, newRepoError(dir, err))
+		}
+		result.data.StashCount, result.data.OldestStashAge = count, age
+	}
+
+	if opts.SinceTag || templateReferences("CommitsSinceTag") {
+		count, err := commitsSinceTag(dir)
+		if err != nil {
+			result.errs = append(result.errs, newRepoError(dir, err))
+		} else {
+			result.data.CommitsSinceTag = &count
+		}
+	}
+
+	if opts.TagsContainingHead {
+		tags, err := tagsContainingHead(dir, opts.TagsContainingHeadMax)
+		if err != nil {
+			result.errs = append(result.errs, newRepoError(dir, err))
+		}
+		result.data.TagsContainingHead = tags
+	}
+
+	if aheadOfDefaultEnabled() {
+		count, err := commitsAheadOfDefault(dir)
+		if err != nil {
+			result.errs = append(result.errs, newRepoError(dir, err))
+		}
+		result.data.CommitsAheadOfDefault = count
+	}
+
+	if branchChangesEnabled() {
+		if aheadOfDefaultEnabled() {
+			// HEAD has commits off the default branch exactly when it has
+			// commits past the merge base, so reuse the count already walked.
+			result.data.HasBranchChanges = result.data.CommitsAheadOfDefault > 0
+		} else {
+			changes, err := hasBranchChanges(dir)
+			if err != nil {
+				result.errs = append(result.errs, newRepoError(dir, err))
 			}
+			result.data.HasBranchChanges = changes
 		}
+	}
 
-		dataCollection = append(dataCollection, data)
+	if tagCountEnabled() {
+		count, err := countTags(dir)
+		if err != nil {
+			result.errs = append(result.errs, newRepoError(dir, err))
+		}
+		result.data.TagCount = count
 	}
 
-	filteredData := applyFilters(dataCollection, opts.CommitCountMax)
+	if shallowEnabled() {
+		result.data.Shallow = isShallow(dir)
+	}
 
-	outputResults(filteredData)
+	if aheadBehindEnabled() {
+		ahead, behind, err := aheadBehind(dir)
+		if err != nil {
+			result.errs = append(result.errs, newRepoError(dir, err))
+		}
+		result.data.Ahead, result.data.Behind = ahead, behind
+	}
 
-	return nil
+	if countingEnabled() {
+		analyzeCommits(dir, &result)
+	}
+
+	if scoreEnabled() {
+		result.data.Score = attentionScore(result.data, time.Now())
+	}
+
+	return result
+}
+
+func analyzeCommits(dir string, result *repoResult) {
+	slog.Debug("counting commits", "dir", dir)
+	var authors map[string]int
+	if authorsEnabled() {
+		authors = make(map[string]int)
+	}
+	countStart := time.Now()
+	commitCount, err := countCommits(dir, authors)
+	warnIfSlow(dir, "count commits", countStart)
+
+	if opts.AllBranches {
+		total, allErr := countAllBranchCommits(dir)
+		if allErr != nil {
+			result.errs = append(result.errs, newRepoError(dir, allErr))
+		} else if total > 0 && (err == nil || err == ErrNoGitLog || errors.Is(err, ErrBrokenHead)) {
+			// HEAD may be an unborn branch, e.g. after git checkout --orphan,
+			// while other branches have history; that is not an empty repo.
+			if err != nil {
+				commitCount, err = 0, nil
+			}
+			result.data.CurrentBranchCommits = commitCount
+			commitCount = total
+		}
+	}
+
+	if err == ErrNoGitLog {
+		slog.Debug("no log found", "dir", dir)
+		result.errs = append(result.errs, newRepoError(dir, err))
+		result.data.Empty = true
+		if !opts.ExcludeCleanEmpty {
+			return
+		}
+	} else if errors.Is(err, ErrBrokenHead) {
+		slog.Debug("dangling HEAD", "dir", dir, "error", err)
+		result.errs = append(result.errs, newRepoError(dir, err))
+		result.data.RepoStatus = "broken-head"
+		return
+	} else if errors.Is(err, ErrCorruptHead) {
+		slog.Debug("corrupt HEAD", "dir", dir, "error", err)
+		result.errs = append(result.errs, newRepoError(dir, err))
+		result.data.RepoStatus = "corrupt"
+		return
+	} else if err != nil {
+		// Open failures (bare, not a repo, permission denied) and unreadable
+		// history affect only this repo; they are recorded for the error
+		// summary and the scan goes on.
+		slog.Debug("failed to count commits", "dir", dir, "error", err)
+		result.errs = append(result.errs, newRepoError(dir, fmt.Errorf("failed to count commits: %w", err)))
+		result.data.RepoStatus = "error"
+		return
+	}
+
+	result.data.CommitCount = commitCount
+	result.data.Authors = topAuthors(authors, opts.ByAuthorMax)
+	slog.Debug("counted commits", "dir", dir, "count", commitCount)
+
+	if opts.NoStatus {
+		result.data.RepoStatus = "skipped"
+		return
+	}
+
+	statusStart := time.Now()
+	status, worktreeStatus, err := getRepoStatus(dir)
+	warnIfSlow(dir, "status", statusStart)
+	if err != nil {
+		result.errs = append(result.errs, newRepoError(dir, err))
+		status = "error"
+		if errors.Is(err, ErrStatusTimeout) {
+			status = "timeout"
+		}
+	}
+	result.data.RepoStatus = status
+	result.data.StatusPorcelain = porcelainSummary(worktreeStatus)
 }
 
-func getRepoStatus(dir string) (string, error) {
-	repo, err := git.PlainOpen(dir)
+// warnIfSlow logs a step that took longer than --slow-threshold, to point
+// at the repos that dominate scan time.
+func warnIfSlow(dir, step string, start time.Time) {
+	elapsed := time.Since(start)
+	slog.Debug("timed step", "dir", dir, "step", step, "elapsed", elapsed)
+	if opts.slowThreshold > 0 && elapsed > opts.slowThreshold {
+		slog.Warn("slow repo", "dir", dir, "step", step, "elapsed", elapsed)
+	}
+}
+
+// countingEnabled reports whether any option needs per-repo commit counts and status.
+func countingEnabled() bool {
+	return jsonOutput() || opts.CommitCountMax != -1 || opts.CommitCountEq != -1 || opts.ExcludeCleanEmpty || opts.EmptyOnly ||
+		opts.Fzf || scoreEnabled() || opts.Baseline != "" || opts.Percentile || opts.AllBranches ||
+		opts.DirtyFirst || opts.Sort == "dirty-first" || opts.Sort == "commits" || opts.Sort == "status" || authorsEnabled() ||
+		templateReferences("CommitCount") || templateReferences("RepoStatus") ||
+		templateReferences("StatusPorcelain") || templateReferences("Empty") ||
+		templateReferences("DirtyCount") || templateReferences("CleanCount")
+}
+
+// jsonOutput reports whether results are written as JSON. commit_count and
+// repo_status are always present there, so they must always be computed or
+// consumers could not tell a zero count from an uncounted one.
+func jsonOutput() bool {
+	return opts.JSONCompactStream || (!opts.PathsOnly && !opts.Print0 && strings.HasPrefix(opts.Output, "json"))
+}
+
+func getRepoStatus(dir string) (string, git.Status, error) {
+	repo, err := openRepo(dir)
 	if err != nil {
-		return "", fmt.Errorf("failed to open repo: %w", err)
+		return "", nil, fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	if opts.FastStatus && quickClean(repo, dir) {
+		slog.Debug("fast status reported clean", "repo", dir)
+		return "clean", nil, nil
 	}
 
 	// show debug message about repo cleanliness
 	slog.Debug("checking repo cleanliness", "repo", dir)
 
-	isClean, err := isRepoClean(repo)
+	isClean, status, err := isRepoClean(repo)
 	if err != nil {
-		return "", fmt.Errorf("failed to check repo cleanliness: %w", err)
+		return "", nil, fmt.Errorf("failed to check repo cleanliness: %w", err)
 	}
 
 	if isClean {
-		return "clean", nil
+		return "clean", status, nil
 	}
 
-	return "dirty", nil
+	return "dirty", status, nil
 }
 
+// statusTimeout bounds a single worktree status attempt.
+const statusTimeout = 2 * time.Second
+
+// gitStatusWithTimeout runs one worktree status, giving up after
+// statusTimeout. go-git's Status cannot be cancelled, so a timed-out call
+// finishes in the background; the buffered channel lets it exit.
 func gitStatusWithTimeout(wt *git.Worktree) (git.Status, error) {
-	status, err := wt.Status()
-	if err != nil {
-		return nil, fmt.Errorf("error getting status: %w", err)
+	type statusResult struct {
+		status git.Status
+		err    error
+	}
+	done := make(chan statusResult, 1)
+
+	go func() {
+		status, err := wt.Status()
+		done <- statusResult{status, err}
+	}()
+
+	select {
+	case result := <-done:
+		if result.err != nil {
+			return nil, fmt.Errorf("error getting status: %w", result.err)
+		}
+		return result.status, nil
+	case <-time.After(statusTimeout):
+		slog.Debug("get worktree status canceled due to timeout", "repo", wt.Filesystem.Root())
+		return nil, ErrStatusTimeout
 	}
-	return status, nil
 }
 
-func isRepoClean(repo *git.Repository) (bool, error) {
+func isRepoClean(repo *git.Repository) (bool, git.Status, error) {
 	slog.Debug("checking repo worktree", "repo", repo)
 	wt, err := repo.Worktree()
 	if err != nil {
-		return false, fmt.Errorf("error getting worktree: %w", err)
+		return false, nil, fmt.Errorf("error getting worktree: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-
-	resultChan := make(chan string, 1)
-
+	// Each attempt gets the full timeout; retrying inside one timeout would
+	// leave backoff delays past it as dead time.
 	var status git.Status
-
-	go func() {
+	err = withRetry("status", wt.Filesystem.Root(), func() error {
+		var err error
 		status, err = gitStatusWithTimeout(wt)
-		if err != nil {
-			slog.Debug("error getting status", "error", err)
-			resultChan <- "Task failed"
-			return
-		}
-		resultChan <- "Task completed successfully"
-	}()
-
-	// Use select to wait for either the task completion or the context cancellation
-	select {
-	case result := <-resultChan:
-		// Task completed before the context was canceled
-		slog.Debug("get worktree status completed", "result", result)
-	case <-ctx.Done():
-		// Context canceled due to timeout
-		slog.Error("get worktree status canceled due to timeout", "repo", wt.Filesystem.Root())
+		return err
+	})
+	if err != nil {
+		return false, nil, err
 	}
 
 	// show debug message about copy status
@@ -206,98 +930,370 @@ func isRepoClean(repo *git.Repository) (bool, error) {
 	}
 
 	if len(statusCopy) == 0 {
-		return true, nil
+		return true, status, nil
 	}
 
-	return false, nil
+	return false, status, nil
 }
 
-func applyFilters(dataCollection []templateData, commitCountMax int) []templateData {
+// porcelainSummary counts files per git porcelain status code, e.g.
+// "M3 A1 ??2". A file staged and modified in the worktree with the same code
+// is counted once.
+func porcelainSummary(status git.Status) string {
+	counts := make(map[git.StatusCode]int)
+	for _, s := range status {
+		if s.Worktree == git.Untracked {
+			counts[git.Untracked]++
+			continue
+		}
+		if s.Staging != git.Unmodified {
+			counts[s.Staging]++
+		}
+		if s.Worktree != git.Unmodified && s.Worktree != s.Staging {
+			counts[s.Worktree]++
+		}
+	}
+
+	codes := []git.StatusCode{git.Modified, git.Added, git.Deleted, git.Renamed, git.Copied, git.UpdatedButUnmerged, git.Untracked}
+	var parts []string
+	for _, code := range codes {
+		if counts[code] == 0 {
+			continue
+		}
+		label := string(code)
+		if code == git.Untracked {
+			label = "??"
+		}
+		parts = append(parts, fmt.Sprintf("%s%d", label, counts[code]))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func applyFilters(dataCollection []templateData) []templateData {
 	var filteredData []templateData
 
 	for _, data := range dataCollection {
-		if commitCountMax == -1 {
-			filteredData = append(filteredData, data)
-		} else if data.CommitCount <= commitCountMax {
-			filteredData = append(filteredData, data)
+		if opts.CommitCountMax != -1 && data.CommitCount > opts.CommitCountMax {
+			if !opts.MarkOverMax {
+				continue
+			}
+			data.OverMax = true
+		}
+
+		if opts.fetchOlderThan != 0 && !data.LastFetchTime.IsZero() && time.Since(data.LastFetchTime) <= opts.fetchOlderThan {
+			continue
+		}
+
+		if opts.newerThan != 0 && (data.LastCommitTime.IsZero() || time.Since(data.LastCommitTime) > opts.newerThan) {
+			continue
+		}
+
+		if opts.CommitCountEq != -1 && data.CommitCount != opts.CommitCountEq {
+			continue
+		}
+
+		if opts.TagCountMin != -1 && data.TagCount < opts.TagCountMin {
+			continue
+		}
+
+		if opts.TagCountMax != -1 && data.TagCount > opts.TagCountMax {
+			continue
+		}
+
+		if opts.NeedsGC && !data.NeedsGC {
+			continue
+		}
+
+		if opts.OnlyWithChangesOnBranch && !data.HasBranchChanges {
+			continue
+		}
+
+		if opts.HasNotesOnly && !data.HasNotes {
+			continue
+		}
+
+		if opts.SkipSubmodules && data.Submodule {
+			continue
+		}
+
+		if opts.MinTracked != -1 && data.TrackedFileCount < opts.MinTracked {
+			continue
+		}
+
+		if opts.MaxTracked != -1 && data.TrackedFileCount > opts.MaxTracked {
+			continue
+		}
+
+		if opts.NoOriginOnly && data.Origin != "" {
+			continue
+		}
+
+		if matchesAny(opts.excludeOrigin, data.Origin) {
+			continue
+		}
+
+		if opts.wrongEmail != nil && opts.wrongEmail.MatchString(data.UserEmail) {
+			continue
+		}
+
+		if opts.ExcludeCleanEmpty && data.CommitCount == 0 && data.RepoStatus == "clean" {
+			continue
+		}
+
+		if opts.EmptyOnly && !data.Empty {
+			continue
 		}
+
+		if opts.SkipShallow && data.Shallow {
+			continue
+		}
+
+		if opts.HasUnmergedOnly && data.CommitsAheadOfDefault == 0 {
+			continue
+		}
+
+		// A detached HEAD has no branch name and so counts as off default, as
+		// does a repo whose default branch cannot be resolved.
+		if opts.OffDefaultOnly && data.DefaultBranch != "" && data.Branch == data.DefaultBranch {
+			continue
+		}
+
+		if opts.activeSince > 0 && (data.LastActivityTime.IsZero() || time.Since(data.LastActivityTime) > opts.activeSince) {
+			continue
+		}
+
+		if opts.staleStashOlderThan > 0 && (data.StashCount == 0 || data.OldestStashAge < opts.staleStashOlderThan) {
+			continue
+		}
+
+		filteredData = append(filteredData, data)
 	}
 
 	return filteredData
 }
 
-func outputResults(filteredData []templateData) {
+func everyNth(dataCollection []templateData, n int) []templateData {
+	var sampled []templateData
+	for i := 0; i < len(dataCollection); i += n {
+		sampled = append(sampled, dataCollection[i])
+	}
+	return sampled
+}
+
+func outputResults(filteredData []templateData, scanErrors []repoError) {
 	var resultBuffer bytes.Buffer
-	tmpl, err := template.New("output").Parse(outputTemplate)
+	renderResults(&resultBuffer, filteredData, scanErrors)
+
+	if opts.OutputFile == "" {
+		out := resultBuffer.Bytes()
+		if opts.StripANSI {
+			out = stripANSI(out)
+		}
+		os.Stdout.Write(out)
+		return
+	}
+
+	// Escape codes are never useful in a file, so they are always stripped.
+	if err := os.WriteFile(opts.OutputFile, stripANSI(resultBuffer.Bytes()), 0o644); err != nil {
+		slog.Error("failed to write output file", "file", opts.OutputFile, "error", err)
+	}
+}
+
+func renderResults(resultBuffer *bytes.Buffer, filteredData []templateData, scanErrors []repoError) {
+	if opts.PathsOnly {
+		records := make([]string, 0, len(filteredData))
+		for _, data := range filteredData {
+			records = append(records, data.Dir)
+		}
+		writeRecords(resultBuffer, records)
+		return
+	}
+
+	if opts.Print0 {
+		for _, data := range filteredData {
+			if !opts.Print0KeepFailed && analysisFailed(data) {
+				slog.Debug("omitting repo from print0 output", "dir", data.Dir, "status", data.RepoStatus)
+				continue
+			}
+			resultBuffer.WriteString(data.Dir + "\x00")
+		}
+		return
+	}
+
+	switch opts.Output {
+	case "table":
+		writeTable(resultBuffer, tableRows(filteredData))
+		return
+	case "json-report":
+		if err := writeJSONReport(resultBuffer, filteredData, scanErrors, opts.Pretty); err != nil {
+			slog.Error("failed to write json report", "error", err)
+			return
+		}
+		return
+	case "json", "jsonl":
+		write := writeJSON
+		if opts.Output == "jsonl" {
+			write = writeJSONL
+		}
+		if err := write(resultBuffer, filteredData, opts.Pretty); err != nil {
+			slog.Error("failed to write json", "error", err)
+			return
+		}
+		return
+	}
+
+	if opts.ReportTemplate != "" {
+		if err := writeReportTemplate(resultBuffer, opts.ReportTemplate, filteredData); err != nil {
+			slog.Error("failed to render report template", "error", err)
+		}
+		return
+	}
+
+	if len(opts.fields) > 0 {
+		writeFields(resultBuffer, filteredData, opts.fields, opts.FieldSeparator)
+		return
+	}
+
+	text := outputTemplate
+	if opts.Fzf {
+		text = fzfTemplate
+	}
+	if opts.Template != "" {
+		text = opts.Template
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+	}
+
+	tmpl, err := template.New("output").Funcs(templateFuncs).Parse(text)
 	if err != nil {
 		slog.Error("failed to parse template", "error", err)
 		return
 	}
 
+	records := make([]string, 0, len(filteredData))
 	for _, data := range filteredData {
-		err := tmpl.Execute(&resultBuffer, data)
+		var record strings.Builder
+		err := tmpl.Execute(&record, data)
 		if err != nil {
 			slog.Error("failed to execute template", "error", err)
 			continue
 		}
+		records = append(records, strings.TrimSuffix(record.String(), "\n"))
 	}
+	writeRecords(resultBuffer, records)
+}
 
-	fmt.Print(resultBuffer.String())
+// writeRecords joins records with --separator and ends the output with a
+// newline unless --no-trailing-newline is set. With the defaults this is one
+// record per line.
+func writeRecords(w *bytes.Buffer, records []string) {
+	if len(records) == 0 {
+		return
+	}
+	w.WriteString(strings.Join(records, opts.Separator))
+	if !opts.NoTrailingNewline {
+		w.WriteString("\n")
+	}
 }
 
-func findSentinelDirs(paths []string, sentinelDir string) ([]string, error) {
-	uniqueDirs := make(map[string]bool)
-	var result []string
+// analysisFailed reports whether the repo was meant to be analyzed but its
+// status could not be determined.
+func analysisFailed(data templateData) bool {
+	if !data.CountCommits {
+		return false
+	}
 
-	for iter, path := range paths {
-		pathInfo, err := os.Stat(path)
-		if err != nil {
-			return []string{}, fmt.Errorf("failed to stat path: %w", err)
-		}
+	switch data.RepoStatus {
+	case "error", "timeout", "unknown", "corrupt", "broken-head":
+		return true
+	}
+	return false
+}
 
-		currentDir, err := filepath.Abs(path)
+func resolveSymlinks(paths []string) ([]string, error) {
+	resolved := make([]string, 0, len(paths))
+	for _, path := range paths {
+		target, err := filepath.EvalSymlinks(path)
 		if err != nil {
-			return []string{}, fmt.Errorf("failed to get absolute path: %w", err)
+			return nil, err
 		}
+		slog.Debug("resolved symlinks", "path", path, "target", target)
+		resolved = append(resolved, target)
+	}
+	return resolved, nil
+}
 
-		if pathInfo.IsDir() && iter != 0 {
-			currentDir = filepath.Dir(path)
+// displayDir returns the repository path as shown in output: relative to
+// --anchor when set, falling back to the absolute path when no relative path
+// exists, then with --trim-prefix removed.
+func displayDir(data templateData) string {
+	dir := data.Dir
+	if opts.Anchor != "" {
+		dir = data.AbsDir
+		if rel, err := filepath.Rel(opts.Anchor, data.AbsDir); err == nil {
+			dir = rel
 		}
+	}
+	return strings.TrimPrefix(dir, opts.TrimPrefix)
+}
 
-		slog.Debug("searching for sentinel dir", "path", path, "currentDir", currentDir, "sentinel", sentinelDir)
+// absAndRelDir returns dir as an absolute path and relative to the current
+// directory. The relative form falls back to the absolute path.
+func absAndRelDir(dir string) (string, string) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
 
-		for currentDir != "/" && !uniqueDirs[currentDir] {
-			sentinelDir := filepath.Join(currentDir, sentinelDir)
-			if _, err := os.Stat(sentinelDir); err == nil {
-				result = append(result, currentDir)
-				uniqueDirs[currentDir] = true
-				break
-			}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return abs, abs
+	}
 
-			currentDir = filepath.Dir(currentDir)
-		}
+	rel, err := filepath.Rel(cwd, abs)
+	if err != nil {
+		return abs, abs
 	}
 
-	return result, nil
+	return abs, rel
+}
+
+// lastFetchTime returns the mtime of FETCH_HEAD, or the zero time if the
+// repo has never been fetched.
+func lastFetchTime(dir string) time.Time {
+	info, err := os.Stat(gitPath(dir, "FETCH_HEAD"))
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
 }
 
-func countCommits(repoPath string) (int, error) {
-	repo, err := git.PlainOpen(repoPath)
+func countCommits(repoPath string, authors map[string]int) (int, error) {
+	repo, err := openRepo(repoPath)
 	if err != nil {
 		return 0, fmt.Errorf("failed to open repo: %w", err)
 	}
 
-	slog.Debug("counting commits", "repo", repoPath)
+	slog.Debug("counting commits", "repo", repoPath, "firstParent", opts.FirstParent)
+
+	if opts.FirstParent {
+		return countFirstParentCommits(repo, repoPath, authors)
+	}
 
 	iter, err := repo.Log(&git.LogOptions{})
 	if err != nil {
-		slog.Debug("failed to query git log", "repo", repoPath)
-		return 0, ErrNoGitLog
+		slog.Debug("failed to query git log", "repo", repoPath, "error", err)
+		return 0, unresolvedHeadError(repoPath, err)
 	}
 
 	count := 0
-	err = iter.ForEach(func(commit *object.Commit) error {
+	err = forEachCommit(repo, iter, func(commit *object.Commit) error {
 		count++
+		if authors != nil {
+			authors[commit.Author.Email]++
+		}
 		return nil
 	})
 	if err != nil {
@@ -307,3 +1303,53 @@ func countCommits(repoPath string) (int, error) {
 
 	return count, nil
 }
+
+// unresolvedHeadError classifies a failure to resolve HEAD. A missing ref is
+// normal in a new repo, but a HEAD left pointing at a deleted branch while
+// other branches exist is reported as broken rather than empty.
+func unresolvedHeadError(repoPath string, err error) error {
+	if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return fmt.Errorf("%w: %w", ErrCorruptHead, err)
+	}
+	if ref, ok := danglingHead(repoPath); ok {
+		return fmt.Errorf("%w: %s: %w", ErrBrokenHead, ref, err)
+	}
+	return ErrNoGitLog
+}
+
+// countFirstParentCommits counts mainline commits by following only the first
+// parent of each commit, like git log --first-parent. When authors is non-nil
+// it also tallies each commit's author email.
+func countFirstParentCommits(repo *git.Repository, repoPath string, authors map[string]int) (int, error) {
+	head, err := repo.Head()
+	if err != nil {
+		slog.Debug("failed to resolve HEAD", "repo", repoPath, "error", err)
+		return 0, unresolvedHeadError(repoPath, err)
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrCorruptHead, err)
+	}
+
+	count := 1
+	if authors != nil {
+		authors[commit.Author.Email]++
+	}
+	for commit.NumParents() > 0 {
+		commit, err = commit.Parent(0)
+		if truncatedByShallowClone(repo, err) {
+			slog.Debug("history truncated by shallow clone", "path", repoPath, "count", count)
+			return count, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to walk first parents: %w", err)
+		}
+		count++
+		if authors != nil {
+			authors[commit.Author.Email]++
+		}
+	}
+
+	return count, nil
+}
@@ -0,0 +1,160 @@
+package herfish
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/jessevdk/go-flags"
+)
+
+// pristineOpts is opts before any flags are parsed.
+var pristineOpts = opts
+
+// setOptions parses args, on top of the flag defaults only, into the global
+// opts for the duration of a test.
+func setOptions(t testing.TB, args ...string) {
+	t.Helper()
+
+	saved := opts
+	t.Cleanup(func() { opts = saved })
+
+	opts = pristineOpts
+
+	if _, err := flags.NewParser(&opts, flags.Default).ParseArgs(args); err != nil {
+		t.Fatalf("failed to parse %v: %v", args, err)
+	}
+	if err := resolveOptions(); err != nil {
+		t.Fatalf("failed to resolve options: %v", err)
+	}
+}
+
+// genFixtures creates n fixture repos under a temp dir with varying commit
+// counts and dirty states, and returns their paths.
+func genFixtures(t testing.TB, n int) []string {
+	t.Helper()
+
+	root := t.TempDir()
+	dirs := make([]string, 0, n)
+	for i := range n {
+		dir := filepath.Join(root, fmt.Sprintf("repo-%04d", i))
+		if err := genFixture(dir, i%5+1, i%3 == 0); err != nil {
+			t.Fatalf("failed to create fixture: %v", err)
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+func TestProcessReposConcurrentOutputIsStable(t *testing.T) {
+	setOptions(t, "--concurrency", "8", "--template", "{{.CommitCount}} {{.RepoStatus}} {{.Dir}}")
+	dirs := genFixtures(t, 24)
+
+	render := func() []byte {
+		var data []templateData
+		for _, result := range processRepos(dirs, 8) {
+			if len(result.errs) > 0 {
+				t.Fatalf("failed to analyze repo: %v", result.errs[0].Err)
+			}
+			data = append(data, result.data)
+		}
+		var buf bytes.Buffer
+		renderResults(&buf, data, nil)
+		return buf.Bytes()
+	}
+
+	want := render()
+	if len(want) == 0 {
+		t.Fatal("expected output")
+	}
+	for range 5 {
+		if got := render(); !bytes.Equal(got, want) {
+			t.Fatalf("output differs between runs:\n%s\nwant:\n%s", got, want)
+		}
+	}
+}
+
+func TestJSONOutputCountsCommits(t *testing.T) {
+	dirs := genFixtures(t, 1)
+
+	for _, args := range [][]string{{"--output", "json"}, {"--output", "jsonl"}, {"--output", "json-report"}, {"--json-compact-stream"}} {
+		setOptions(t, args...)
+		result := analyzeRepo(dirs[0])
+		if result.data.CommitCount != 1 || result.data.RepoStatus != "dirty" {
+			t.Errorf("%v: commit count %d, status %q, want 1, dirty", args, result.data.CommitCount, result.data.RepoStatus)
+		}
+	}
+}
+
+func TestAnalyzeRepoRecordsOpenFailure(t *testing.T) {
+	setOptions(t, "--output", "json")
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	result := analyzeRepo(dir)
+	if result.data.RepoStatus != "error" {
+		t.Errorf("status = %q, want error", result.data.RepoStatus)
+	}
+	if len(result.errs) == 0 || result.errs[0].Category != "not-repo" {
+		t.Errorf("errs = %v, want a not-repo error", result.errs)
+	}
+}
+
+func TestCountCommitsDetectsDanglingHead(t *testing.T) {
+	setOptions(t)
+	dir := genFixtures(t, 1)[0]
+	repo, err := openRepo(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName("gone"))
+	if err := repo.Storer.SetReference(head); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{nil, {"--first-parent"}} {
+		setOptions(t, args...)
+		_, err := countCommits(dir, nil)
+		if !errors.Is(err, ErrBrokenHead) || !errors.Is(err, ErrCorruptHead) {
+			t.Errorf("%v: err = %v, want a broken HEAD", args, err)
+		}
+		if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+			t.Errorf("%v: err = %v, want the go-git error wrapped", args, err)
+		}
+	}
+
+	setOptions(t, "--output", "json")
+	result := analyzeRepo(dir)
+	if result.data.RepoStatus != "broken-head" || result.data.Empty {
+		t.Errorf("status = %q, empty = %v, want broken-head", result.data.RepoStatus, result.data.Empty)
+	}
+}
+
+func TestDefaultOutputShowsTimesOnlyWhenAsked(t *testing.T) {
+	data := []templateData{{Dir: "/a", LastCommitTime: time.Now().Add(-72 * time.Hour)}}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"--newer-than", "7d"}, want: "/a\n"},
+		{args: []string{"--recent"}, want: "/a\n"},
+		{args: []string{"--relative-time"}, want: "committed 3 days ago, fetched never /a\n"},
+	}
+
+	for _, tt := range tests {
+		setOptions(t, tt.args...)
+		var buf bytes.Buffer
+		renderResults(&buf, data, nil)
+		if got := buf.String(); got != tt.want {
+			t.Errorf("output with %v = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package herfish
+
+import (
+	"bufio"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const herfishIgnoreFile = ".herfishignore"
+
+// ignoreCache holds the parsed .herfishignore patterns per directory so each
+// file is read only once per scan.
+type ignoreCache map[string][]string
+
+func (c ignoreCache) patterns(dir string) []string {
+	if patterns, ok := c[dir]; ok {
+		return patterns
+	}
+
+	var patterns []string
+	f, err := os.Open(filepath.Join(dir, herfishIgnoreFile))
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			patterns = append(patterns, strings.TrimSuffix(line, "/"))
+		}
+		f.Close()
+		slog.Debug("loaded ignore file", "dir", dir, "patterns", patterns)
+	}
+
+	c[dir] = patterns
+	return patterns
+}
+
+// ignored reports whether dir, or any directory between it and an ancestor
+// holding a .herfishignore, matches one of that file's glob patterns.
+func (c ignoreCache) ignored(dir string) bool {
+	for root := filepath.Dir(dir); ; root = filepath.Dir(root) {
+		patterns := c.patterns(root)
+		if len(patterns) > 0 {
+			rel, err := filepath.Rel(root, dir)
+			if err == nil && matchesIgnore(patterns, rel) {
+				return true
+			}
+		}
+
+		if root == filepath.Dir(root) {
+			return false
+		}
+	}
+}
+
+// matchesIgnore matches patterns against each leading portion of rel and
+// against each individual component, so "vendor" excludes vendor/lib too.
+func matchesIgnore(patterns []string, rel string) bool {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := range parts {
+		prefix := strings.Join(parts[:i+1], "/")
+		for _, pattern := range patterns {
+			if matched, _ := filepath.Match(pattern, prefix); matched {
+				return true
+			}
+			if matched, _ := filepath.Match(pattern, parts[i]); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func skipIgnored(dirs []string) []string {
+	cache := make(ignoreCache)
+
+	var kept []string
+	for _, dir := range dirs {
+		if cache.ignored(dir) {
+			slog.Debug("skipping dir matched by ignore file", "dir", dir)
+			continue
+		}
+		kept = append(kept, dir)
+	}
+	return kept
+}
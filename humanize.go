@@ -0,0 +1,69 @@
+package herfish
+
+import (
+	"fmt"
+	"time"
+)
+
+var templateFuncs = map[string]any{
+	"ago":       humanizeSince,
+	"fmtTime":   formatTime,
+	"baseline":  func() bool { return opts.baseline != nil },
+	"showTimes": showTimes,
+}
+
+// showTimes reports whether the default output includes the last commit and
+// last fetch times. Filters and sorts that use times do not turn this on, so
+// they never change the shape of a record.
+func showTimes() bool {
+	return opts.ShowTimes || opts.RelativeTime
+}
+
+// formatTime renders t as RFC 3339, or relative to now with --relative-time.
+// The zero time renders as "never".
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	if opts.RelativeTime {
+		return humanizeSince(t)
+	}
+	return t.Format(time.RFC3339)
+}
+
+// humanizeSince describes how long ago t was, e.g. "3 days ago".
+func humanizeSince(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+
+	d := time.Since(t)
+	suffix := "ago"
+	if d < 0 {
+		d = -d
+		suffix = "from now"
+	}
+
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"year", 365 * 24 * time.Hour},
+		{"month", 30 * 24 * time.Hour},
+		{"week", 7 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+
+	for _, unit := range units {
+		if n := int(d / unit.size); n >= 1 {
+			if n > 1 {
+				return fmt.Sprintf("%d %ss %s", n, unit.name, suffix)
+			}
+			return fmt.Sprintf("1 %s %s", unit.name, suffix)
+		}
+	}
+
+	return "just now"
+}
@@ -0,0 +1,27 @@
+package herfish
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5/config"
+)
+
+func identityEnabled() bool {
+	return opts.WrongEmail != "" || templateReferences("UserName") || templateReferences("UserEmail")
+}
+
+// userIdentity returns the user.name and user.email a commit in dir would
+// use, with repository settings overriding global and system config.
+func userIdentity(dir string) (string, string, error) {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	cfg, err := repo.ConfigScoped(config.SystemScope)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read config: %w", err)
+	}
+
+	return cfg.User.Name, cfg.User.Email, nil
+}
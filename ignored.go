@@ -0,0 +1,80 @@
+package herfish
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// countIgnoredFiles counts files in the worktree that are matched by the
+// repo's gitignore rules. Files inside an ignored directory are all counted.
+func countIgnoredFiles(dir string) (int, error) {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return 0, fmt.Errorf("error getting worktree: %w", err)
+	}
+
+	patterns, err := gitignore.ReadPatterns(wt.Filesystem, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read gitignore patterns: %w", err)
+	}
+	patterns = append(patterns, wt.Excludes...)
+	matcher := gitignore.NewMatcher(patterns)
+
+	count := 0
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if !matcher.Match(strings.Split(filepath.ToSlash(rel), "/"), d.IsDir()) {
+			return nil
+		}
+
+		if !d.IsDir() {
+			count++
+			return nil
+		}
+
+		n, err := countFiles(path)
+		if err != nil {
+			return err
+		}
+		count += n
+		return filepath.SkipDir
+	})
+
+	return count, err
+}
+
+func countFiles(root string) (int, error) {
+	count := 0
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
@@ -0,0 +1,154 @@
+package herfish
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// collectPaths gathers input paths from arguments and/or stdin according to
+// source. In "both" mode stdin is skipped when it is a terminal and
+// arguments were given, so herfish does not block waiting for input. With
+// --max-input, reading stops once that many paths have been collected.
+func collectPaths(args []string, source string) ([]string, error) {
+	var paths []string
+	if source != "stdin" {
+		paths = append(paths, args...)
+	}
+
+	limit := -1
+	if opts.MaxInput > 0 {
+		if len(paths) >= opts.MaxInput {
+			if len(paths) > opts.MaxInput {
+				warnInputLimit()
+			}
+			return paths[:opts.MaxInput], nil
+		}
+		limit = opts.MaxInput - len(paths)
+	}
+
+	readStdin := source == "stdin" || (source == "both" && (len(args) == 0 || !isTerminal(os.Stdin)))
+	if !readStdin {
+		return paths, nil
+	}
+
+	// Only prompt when a person is typing; piped input is already on its way.
+	if isTerminal(os.Stdin) && !opts.NoWaitMessage {
+		fmt.Fprintln(os.Stderr, "Waiting for stdin...")
+	}
+	stdinPaths, err := readPaths(os.Stdin, opts.InputFormat, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(paths, stdinPaths...), nil
+}
+
+// readPaths reads paths in the given format. A non-negative limit stops
+// reading after that many paths, leaving the rest of r unread.
+func readPaths(r io.Reader, format string, limit int) ([]string, error) {
+	if format == "json" {
+		return readJSONPaths(r, limit)
+	}
+
+	var paths []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if len(paths) == limit {
+			warnInputLimit()
+			break
+		}
+		paths = append(paths, scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading input: %w", err)
+	}
+
+	return paths, nil
+}
+
+// readJSONPaths decodes the array one element at a time so a limit can stop
+// reading without holding the whole input in memory.
+func readJSONPaths(r io.Reader, limit int) ([]string, error) {
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, fmt.Errorf("input must be a JSON array of strings: %w", jsonArrayError(tok, err))
+	}
+
+	var paths []string
+	for i := 0; dec.More(); i++ {
+		if len(paths) == limit {
+			warnInputLimit()
+			return paths, nil
+		}
+
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			return nil, fmt.Errorf("input must be a JSON array of strings: %w", err)
+		}
+		path, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("input must be a JSON array of strings: element %d is %T", i, v)
+		}
+		paths = append(paths, path)
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("input must be a JSON array of strings: %w", err)
+	}
+
+	return paths, nil
+}
+
+func jsonArrayError(tok json.Token, err error) error {
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("got %v", tok)
+}
+
+func warnInputLimit() {
+	slog.Warn("input limit reached; ignoring remaining paths", "maxInput", opts.MaxInput)
+}
+
+// expandGlobs expands each path as a filepath.Glob pattern, with a leading ~
+// meaning the home directory. Patterns that match nothing are dropped with a
+// warning. Per-line sentinels carry over to every expanded path.
+func expandGlobs(paths []string, lineSentinels map[string]string) ([]string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = ""
+	}
+
+	var expanded []string
+	for _, path := range paths {
+		pattern := path
+		if home != "" && (pattern == "~" || strings.HasPrefix(pattern, "~/")) {
+			pattern = home + pattern[1:]
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", path, err)
+		}
+		if len(matches) == 0 {
+			slog.Warn("glob matched no paths", "pattern", path)
+			continue
+		}
+
+		if sentinel, ok := lineSentinels[path]; ok {
+			for _, match := range matches {
+				lineSentinels[match] = sentinel
+			}
+		}
+		expanded = append(expanded, matches...)
+	}
+
+	return expanded, nil
+}
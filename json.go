@@ -0,0 +1,41 @@
+package herfish
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+func marshalJSON(v any, pretty bool) ([]byte, error) {
+	if pretty {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	return json.Marshal(v)
+}
+
+func writeJSON(w io.Writer, filteredData []templateData, pretty bool) error {
+	if filteredData == nil {
+		filteredData = []templateData{}
+	}
+
+	b, err := marshalJSON(filteredData, pretty)
+	if err != nil {
+		return fmt.Errorf("failed to marshal results: %w", err)
+	}
+
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
+
+func writeJSONL(w io.Writer, filteredData []templateData, pretty bool) error {
+	for _, data := range filteredData {
+		b, err := marshalJSON(data, pretty)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", data.Dir, err)
+		}
+		if _, err := fmt.Fprintln(w, string(b)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
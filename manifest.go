@@ -0,0 +1,62 @@
+package herfish
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// manifestEntry is one line of a repo manifest: a path and an optional label.
+type manifestEntry struct {
+	path  string
+	label string
+}
+
+// readManifest parses a manifest file. Each line holds a path, optionally
+// followed by a tab and a label. Blank lines and lines starting with # are
+// ignored.
+func readManifest(file string) ([]manifestEntry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer f.Close()
+
+	var entries []manifestEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		path, label, _ := strings.Cut(line, "\t")
+		entries = append(entries, manifestEntry{
+			path:  strings.TrimSpace(path),
+			label: strings.TrimSpace(label),
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	return entries, nil
+}
+
+// manifestLabel returns the label of the first entry whose path is dir or
+// lies inside it.
+func manifestLabel(manifest []manifestEntry, dir string) string {
+	for _, entry := range manifest {
+		abs, err := filepath.Abs(entry.path)
+		if err != nil {
+			continue
+		}
+		if abs == dir || strings.HasPrefix(abs, dir+string(filepath.Separator)) {
+			return entry.label
+		}
+	}
+	return ""
+}
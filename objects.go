@@ -0,0 +1,95 @@
+package herfish
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Thresholds mirror git's gc.auto and gc.autoPackLimit defaults.
+const (
+	gcLooseObjectLimit = 6700
+	gcPackLimit        = 50
+)
+
+func countObjectsEnabled() bool {
+	return opts.CountObjects || opts.NeedsGC || templateReferences("LooseObjects") ||
+		templateReferences("PackFiles") || templateReferences("NeedsGC")
+}
+
+// countObjects reports the number of loose objects and pack files in the
+// repo's object database, like git count-objects.
+func countObjects(dir string) (loose int, packs int, err error) {
+	objectsDir := gitPath(dir, "objects")
+
+	entries, err := os.ReadDir(objectsDir)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || len(entry.Name()) != 2 {
+			continue
+		}
+		objects, err := os.ReadDir(filepath.Join(objectsDir, entry.Name()))
+		if err != nil {
+			return 0, 0, err
+		}
+		loose += len(objects)
+	}
+
+	packFiles, err := os.ReadDir(filepath.Join(objectsDir, "pack"))
+	if err != nil && !os.IsNotExist(err) {
+		return 0, 0, err
+	}
+	for _, entry := range packFiles {
+		if strings.HasSuffix(entry.Name(), ".pack") {
+			packs++
+		}
+	}
+
+	return loose, packs, nil
+}
+
+func needsGC(loose, packs int) bool {
+	return loose > gcLooseObjectLimit || packs > gcPackLimit
+}
+
+func trackedCountEnabled() bool {
+	return opts.MinTracked != -1 || opts.MaxTracked != -1 || templateReferences("TrackedFileCount")
+}
+
+// countTrackedFiles returns the number of entries in the repo index, a cheap
+// proxy for checkout size that avoids walking the worktree.
+func countTrackedFiles(dir string) (int, error) {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	return len(idx.Entries), nil
+}
+
+// shallowEnabled is on whenever commits are counted, since a shallow clone's
+// count covers only the fetched depth and is flagged as approximate.
+func shallowEnabled() bool {
+	return opts.SkipShallow || countingEnabled() || templateReferences("Shallow")
+}
+
+// isShallow reports whether dir is a shallow clone, i.e. its storer lists
+// cut-off commits. Going through the storer also finds the shallow file of
+// linked worktrees and submodule checkouts.
+func isShallow(dir string) bool {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return false
+	}
+	shallow, err := repo.Storer.Shallow()
+	return err == nil && len(shallow) > 0
+}
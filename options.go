@@ -0,0 +1,229 @@
+package herfish
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resolveOptions validates flag values and fills derived, unexported fields
+// of opts once flags have been parsed.
+func resolveOptions() error {
+	if opts.CommitCountEq != -1 && opts.CommitCountMax != -1 && opts.CommitCountEq > opts.CommitCountMax {
+		return fmt.Errorf("--commit-count-eq %d exceeds --commit-count-max %d", opts.CommitCountEq, opts.CommitCountMax)
+	}
+
+	if opts.TagCountMin != -1 && opts.TagCountMax != -1 && opts.TagCountMin > opts.TagCountMax {
+		return fmt.Errorf("--tag-count-min %d exceeds --tag-count-max %d", opts.TagCountMin, opts.TagCountMax)
+	}
+
+	if opts.OutputFile != "" && !opts.outputSet {
+		if format, ok := outputFormatForFile(opts.OutputFile); ok {
+			opts.Output = format
+		}
+	}
+
+	if opts.FetchOlderThan != "" {
+		d, err := parseDuration(opts.FetchOlderThan)
+		if err != nil {
+			return fmt.Errorf("invalid --fetch-older-than: %w", err)
+		}
+		opts.fetchOlderThan = d
+	}
+
+	if opts.NewerThan != "" {
+		d, err := parseDuration(opts.NewerThan)
+		if err != nil {
+			return fmt.Errorf("invalid --newer-than: %w", err)
+		}
+		opts.newerThan = d
+	}
+
+	if opts.ActiveSince != "" {
+		d, err := parseDuration(opts.ActiveSince)
+		if err != nil {
+			return fmt.Errorf("invalid --active-since: %w", err)
+		}
+		opts.activeSince = d
+	}
+
+	if opts.StaleStashOlderThan != "" {
+		d, err := parseDuration(opts.StaleStashOlderThan)
+		if err != nil {
+			return fmt.Errorf("invalid --stale-stash-older-than: %w", err)
+		}
+		opts.staleStashOlderThan = d
+	}
+
+	if opts.Watch != "" {
+		d, err := parseDuration(opts.Watch)
+		if err != nil {
+			return fmt.Errorf("invalid --watch: %w", err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("invalid --watch: interval must be positive")
+		}
+		opts.watch = d
+	}
+
+	if opts.SlowThreshold != "" {
+		d, err := parseDuration(opts.SlowThreshold)
+		if err != nil {
+			return fmt.Errorf("invalid --slow-threshold: %w", err)
+		}
+		opts.slowThreshold = d
+	}
+
+	if opts.Deadline != "" {
+		d, err := parseDuration(opts.Deadline)
+		if err != nil {
+			return fmt.Errorf("invalid --deadline: %w", err)
+		}
+		opts.deadlineAt = time.Now().Add(d)
+	}
+
+	for _, pattern := range opts.ExcludeOrigin {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid --exclude-origin: %w", err)
+		}
+		opts.excludeOrigin = append(opts.excludeOrigin, re)
+	}
+
+	if opts.Fields != "" {
+		fields, err := parseFields(opts.Fields)
+		if err != nil {
+			return fmt.Errorf("invalid --fields: %w", err)
+		}
+		opts.fields = fields
+	}
+
+	if opts.Anchor != "" {
+		anchor, err := filepath.Abs(opts.Anchor)
+		if err != nil {
+			return fmt.Errorf("invalid --anchor: %w", err)
+		}
+		opts.Anchor = anchor
+	}
+
+	if opts.Baseline != "" {
+		baseline, err := readBaseline(opts.Baseline)
+		if err != nil {
+			return err
+		}
+		opts.baseline = baseline
+	}
+
+	if opts.WrongEmail != "" {
+		re, err := regexp.Compile(opts.WrongEmail)
+		if err != nil {
+			return fmt.Errorf("invalid --wrong-email: %w", err)
+		}
+		opts.wrongEmail = re
+	}
+
+	return nil
+}
+
+// outputFormatForFile infers an --output format from a file extension.
+func outputFormatForFile(path string) (string, bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json", true
+	case ".jsonl", ".ndjson":
+		return "jsonl", true
+	case ".txt":
+		return "text", true
+	}
+	return "", false
+}
+
+// parseDuration extends time.ParseDuration with d (day) and w (week) suffixes,
+// e.g. "3d" or "2w".
+func parseDuration(s string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}
+
+	for suffix, unit := range units {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			count, err := strconv.ParseFloat(n, 64)
+			if err != nil {
+				return 0, fmt.Errorf("failed to parse duration %q: %w", s, err)
+			}
+			return time.Duration(count * float64(unit)), nil
+		}
+	}
+
+	return time.ParseDuration(s)
+}
+
+// logConfig reports the effective value of every flag. --dump-config writes
+// it to stderr as name=value lines regardless of the log level; otherwise it
+// is logged only at debug level.
+func logConfig() {
+	if !opts.DumpConfig && opts.logLevel > slog.LevelDebug {
+		return
+	}
+
+	v := reflect.ValueOf(opts)
+	t := v.Type()
+
+	attrs := make([]slog.Attr, 0, t.NumField())
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name := field.Tag.Get("long")
+		if !field.IsExported() || name == "" {
+			continue
+		}
+		attrs = append(attrs, slog.Any(name, v.Field(i).Interface()))
+	}
+
+	if opts.DumpConfig {
+		for _, attr := range attrs {
+			fmt.Fprintf(os.Stderr, "%s=%v\n", attr.Key, attr.Value)
+		}
+		return
+	}
+
+	slog.LogAttrs(context.Background(), slog.LevelDebug, "effective config", attrs...)
+}
+
+// changedOptions returns the flags whose values differ from their defaults,
+// keyed by long flag name.
+func changedOptions() map[string]any {
+	v := reflect.ValueOf(opts)
+	t := v.Type()
+
+	changed := make(map[string]any)
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name := field.Tag.Get("long")
+		if !field.IsExported() || name == "" {
+			continue
+		}
+
+		value := v.Field(i)
+		if value.Kind() == reflect.Slice {
+			if value.Len() > 0 {
+				changed[name] = value.Interface()
+			}
+			continue
+		}
+
+		def, hasDefault := field.Tag.Lookup("default")
+		if (hasDefault && fmt.Sprint(value.Interface()) != def) || (!hasDefault && !value.IsZero()) {
+			changed[name] = value.Interface()
+		}
+	}
+
+	return changed
+}
@@ -0,0 +1,22 @@
+package herfish
+
+import "sort"
+
+// assignPercentiles sets each repository's Percentile to the percentile rank
+// of its commit count within dataCollection: the share of repositories with
+// fewer commits, counting ties as half, so the result lies in (0, 100).
+func assignPercentiles(dataCollection []templateData) {
+	counts := make([]int, len(dataCollection))
+	for i, data := range dataCollection {
+		counts[i] = data.CommitCount
+	}
+	sort.Ints(counts)
+
+	n := float64(len(counts))
+	for i := range dataCollection {
+		count := dataCollection[i].CommitCount
+		below := sort.SearchInts(counts, count)
+		equal := sort.SearchInts(counts, count+1) - below
+		dataCollection[i].Percentile = (float64(below) + float64(equal)/2) / n * 100
+	}
+}
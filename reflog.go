@@ -0,0 +1,86 @@
+package herfish
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reflogEntry is one line of a reflog file under .git/logs.
+type reflogEntry struct {
+	oldHash string
+	newHash string
+	when    time.Time
+	message string
+}
+
+// readReflog parses the reflog of ref (e.g. "HEAD" or "refs/stash") in dir,
+// oldest entry first. A ref without a reflog yields no entries.
+func readReflog(dir, ref string) ([]reflogEntry, error) {
+	f, err := os.Open(gitPath(dir, "logs/"+ref))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open reflog: %w", err)
+	}
+	defer f.Close()
+
+	var entries []reflogEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entry, ok := parseReflogLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read reflog: %w", err)
+	}
+
+	return entries, nil
+}
+
+// parseReflogLine parses "<old> <new> <name> <<email>> <unix> <tz>\t<message>".
+func parseReflogLine(line string) (reflogEntry, bool) {
+	header, message, _ := strings.Cut(line, "\t")
+
+	fields := strings.Fields(header)
+	if len(fields) < 4 {
+		return reflogEntry{}, false
+	}
+
+	// The committer name may contain spaces, so the timestamp and zone are
+	// taken from the end of the header.
+	unix, err := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+	if err != nil {
+		return reflogEntry{}, false
+	}
+
+	return reflogEntry{
+		oldHash: fields[0],
+		newHash: fields[1],
+		when:    time.Unix(unix, 0),
+		message: message,
+	}, true
+}
+
+func activityEnabled() bool {
+	return opts.ActiveSince != "" || templateReferences("LastActivityTime")
+}
+
+// lastActivityTime returns the time of the newest HEAD reflog entry, which
+// records checkouts, resets and pulls as well as commits. It is zero when
+// the repository has no HEAD reflog.
+func lastActivityTime(dir string) (time.Time, error) {
+	entries, err := readReflog(dir, "HEAD")
+	if err != nil || len(entries) == 0 {
+		return time.Time{}, err
+	}
+	return entries[len(entries)-1].when, nil
+}
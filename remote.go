@@ -0,0 +1,101 @@
+package herfish
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// originEnabled reports whether any option needs the origin remote URL.
+func originEnabled() bool {
+	return opts.DedupeByOrigin || opts.NoOriginOnly || len(opts.ExcludeOrigin) > 0 || templateReferences("Origin")
+}
+
+// getOrigin returns the first URL of the origin remote, or an empty string
+// when the repo has no origin.
+func getOrigin(dir string) (string, error) {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	remote, err := repo.Remote("origin")
+	if errors.Is(err, git.ErrRemoteNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get origin remote: %w", err)
+	}
+
+	urls := remote.Config().URLs
+	if len(urls) == 0 {
+		return "", nil
+	}
+
+	return urls[0], nil
+}
+
+// dedupeByOrigin keeps the first repo seen for each origin URL. Repos without
+// an origin are always kept.
+func dedupeByOrigin(dataCollection []templateData) []templateData {
+	seen := make(map[string]bool)
+	var result []templateData
+
+	for _, data := range dataCollection {
+		if data.Origin != "" {
+			if seen[data.Origin] {
+				slog.Debug("skipping duplicate origin", "dir", data.Dir, "origin", data.Origin)
+				continue
+			}
+			seen[data.Origin] = true
+		}
+		result = append(result, data)
+	}
+
+	return result
+}
+
+// matchesAny reports whether origin is non-empty and matches any pattern.
+func matchesAny(patterns []*regexp.Regexp, origin string) bool {
+	if origin == "" {
+		return false
+	}
+
+	for _, re := range patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteURLsEnabled() bool {
+	return templateReferences("FetchURL") || templateReferences("PushURL")
+}
+
+// originURLs returns the fetch and push URLs of the origin remote. go-git
+// merges pushurl entries into RemoteConfig.URLs, so they are read from the
+// raw config instead. Without a pushurl, git pushes to the fetch URL.
+func originURLs(dir string) (string, string, error) {
+	repo, err := openRepo(dir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read config: %w", err)
+	}
+
+	origin := cfg.Raw.Section("remote").Subsection("origin")
+	fetchURL := origin.Option("url")
+	pushURL := origin.Option("pushurl")
+	if pushURL == "" {
+		pushURL = fetchURL
+	}
+
+	return fetchURL, pushURL, nil
+}
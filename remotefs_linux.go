@@ -0,0 +1,118 @@
+//go:build linux
+
+package herfish
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Filesystem magic numbers from statfs(2) for common network filesystems.
+// They are 32-bit values; Statfs_t.Type is int32 on 386 and arm, so it is
+// converted with uint32 to keep cifs and smb2 from being sign-extended.
+var remoteFSTypes = map[uint32]string{
+	0x6969:     "nfs",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x517b:     "smb",
+	0x564c:     "ncp",
+	0x73757245: "coda",
+	0x6b414653: "afs",
+	0x01161970: "gfs2",
+	0x47504653: "gpfs",
+	0x00c36400: "ceph",
+}
+
+// fuseMagic is shared by every FUSE filesystem, local ones like ntfs-3g and
+// gocryptfs included, so FUSE mounts are judged by their subtype instead.
+const fuseMagic uint32 = 0x65735546
+
+// remoteFUSETypes are FUSE subtypes, as listed in /proc/self/mountinfo, that
+// talk to another machine.
+var remoteFUSETypes = map[string]bool{
+	"fuse.sshfs":     true,
+	"fuse.s3fs":      true,
+	"fuse.gcsfuse":   true,
+	"fuse.curlftpfs": true,
+}
+
+// isRemoteFS reports whether dir lives on a known network filesystem.
+func isRemoteFS(dir string) (bool, string) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return false, ""
+	}
+
+	magic := uint32(stat.Type)
+	if magic == fuseMagic {
+		fsType := mountFSType(dir)
+		return remoteFUSETypes[fsType], fsType
+	}
+
+	name, ok := remoteFSTypes[magic]
+	return ok, name
+}
+
+// mountFSType returns the filesystem type of the mount holding dir, read
+// from the longest matching mount point in /proc/self/mountinfo.
+func mountFSType(dir string) string {
+	path, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		path = dir
+	}
+
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	best, fsType := "", ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Fields: id parent major:minor root mountpoint options... - fstype source super
+		pre, post, ok := strings.Cut(scanner.Text(), " - ")
+		fields, postFields := strings.Fields(pre), strings.Fields(post)
+		if !ok || len(fields) < 5 || len(postFields) == 0 {
+			continue
+		}
+
+		mountPoint := unescapeMountinfo(fields[4])
+		if !pathWithin(path, mountPoint) || len(mountPoint) < len(best) {
+			continue
+		}
+		best, fsType = mountPoint, postFields[0]
+	}
+
+	return fsType
+}
+
+func pathWithin(path, dir string) bool {
+	return dir == "/" || path == dir || strings.HasPrefix(path, dir+"/")
+}
+
+// unescapeMountinfo decodes the octal escapes (\040 for space and so on)
+// the kernel uses in mountinfo paths.
+func unescapeMountinfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && isOctal(s[i+1]) && isOctal(s[i+2]) && isOctal(s[i+3]) {
+			b.WriteByte((s[i+1]-'0')<<6 | (s[i+2]-'0')<<3 | (s[i+3] - '0'))
+			i += 3
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isOctal(c byte) bool {
+	return c >= '0' && c <= '7'
+}
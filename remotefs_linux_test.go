@@ -0,0 +1,47 @@
+//go:build linux
+
+package herfish
+
+import "testing"
+
+func TestUnescapeMountinfo(t *testing.T) {
+	tests := map[string]string{
+		"/mnt/data":          "/mnt/data",
+		`/mnt/my\040drive`:   "/mnt/my drive",
+		`/mnt/tab\011name`:   "/mnt/tab\tname",
+		`/mnt/back\134slash`: `/mnt/back\slash`,
+		`/mnt/short\04`:      `/mnt/short\04`,
+	}
+
+	for in, want := range tests {
+		if got := unescapeMountinfo(in); got != want {
+			t.Errorf("unescapeMountinfo(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestPathWithin(t *testing.T) {
+	tests := []struct {
+		path, dir string
+		want      bool
+	}{
+		{path: "/mnt/a/repo", dir: "/mnt/a", want: true},
+		{path: "/mnt/a", dir: "/mnt/a", want: true},
+		{path: "/mnt/ab", dir: "/mnt/a", want: false},
+		{path: "/home", dir: "/", want: true},
+	}
+
+	for _, tt := range tests {
+		if got := pathWithin(tt.path, tt.dir); got != tt.want {
+			t.Errorf("pathWithin(%q, %q) = %v, want %v", tt.path, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestRemoteFSTypesMatchSignedStatfsType(t *testing.T) {
+	// On 386 and arm Statfs_t.Type is int32, so cifs arrives negative.
+	var cifs int32 = -0x00acb2be
+	if got := remoteFSTypes[uint32(cifs)]; got != "cifs" {
+		t.Errorf("remoteFSTypes[uint32(%d)] = %q, want cifs", cifs, got)
+	}
+}
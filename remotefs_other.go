@@ -0,0 +1,8 @@
+//go:build !linux
+
+package herfish
+
+// isRemoteFS is not implemented on this platform, so every repo is processed.
+func isRemoteFS(dir string) (bool, string) {
+	return false, ""
+}
@@ -0,0 +1,91 @@
+package herfish
+
+import (
+	"fmt"
+	"io"
+	"text/template"
+	"time"
+)
+
+// Version is reported in json-report metadata. Release builds override it
+// with -ldflags "-X github.com/taylormonacelli/herfish.Version=...".
+var Version = "dev"
+
+type reportError struct {
+	Dir      string `json:"dir"`
+	Category string `json:"category"`
+	Error    string `json:"error"`
+}
+
+type jsonReport struct {
+	Version   string         `json:"version"`
+	ScannedAt time.Time      `json:"scanned_at"`
+	Sentinel  string         `json:"sentinel"`
+	Total     int            `json:"total"`
+	Filters   map[string]any `json:"filters"`
+	Repos     []templateData `json:"repos"`
+	Errors    []reportError  `json:"errors"`
+}
+
+// writeJSONReport wraps results in a self-describing document with scan
+// metadata, the non-default options in effect and per-repo errors.
+func writeJSONReport(w io.Writer, filteredData []templateData, scanErrors []repoError, pretty bool) error {
+	report := jsonReport{
+		Version:   Version,
+		ScannedAt: time.Now().UTC(),
+		Sentinel:  opts.Sentinel,
+		Total:     len(filteredData),
+		Filters:   changedOptions(),
+		Repos:     filteredData,
+		Errors:    []reportError{},
+	}
+	if report.Repos == nil {
+		report.Repos = []templateData{}
+	}
+
+	for _, e := range scanErrors {
+		report.Errors = append(report.Errors, reportError{Dir: e.Dir, Category: e.Category, Error: e.Err.Error()})
+	}
+
+	b, err := marshalJSON(report, pretty)
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
+
+// reportTemplateData is what --report-template sees: every repository at
+// once plus aggregates that a per-repo template cannot compute.
+type reportTemplateData struct {
+	Repos      []templateData
+	Total      int
+	DirtyCount int
+	CleanCount int
+	ScannedAt  time.Time
+}
+
+// writeReportTemplate executes text once over the whole result set.
+func writeReportTemplate(w io.Writer, text string, filteredData []templateData) error {
+	tmpl, err := template.New("report").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return fmt.Errorf("failed to parse report template: %w", err)
+	}
+
+	data := reportTemplateData{
+		Repos:     filteredData,
+		Total:     len(filteredData),
+		ScannedAt: time.Now(),
+	}
+	for _, repo := range filteredData {
+		switch repo.RepoStatus {
+		case "dirty":
+			data.DirtyCount++
+		case "clean":
+			data.CleanCount++
+		}
+	}
+
+	return tmpl.Execute(w, data)
+}
@@ -0,0 +1,49 @@
+package herfish
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+)
+
+const retryBaseDelay = 100 * time.Millisecond
+
+func withRetry(op string, dir string, fn func() error) error {
+	delay := retryBaseDelay
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= opts.Retries || !isRetryable(err) {
+			return err
+		}
+
+		slog.Debug("retrying", "op", op, "dir", dir, "attempt", attempt+1, "delay", delay, "error", err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// isRetryable reports whether err is a transient I/O failure worth retrying,
+// as seen on busy or network filesystems. Everything else, such as a missing
+// repo, corrupt objects or a status timeout, fails the same way again.
+func isRetryable(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.EIO, syscall.EAGAIN, syscall.ESTALE, syscall.EINTR, syscall.ETIMEDOUT} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+func openRepo(dir string) (*git.Repository, error) {
+	var repo *git.Repository
+	err := withRetry("open", dir, func() error {
+		var err error
+		repo, err = git.PlainOpen(dir)
+		return err
+	})
+	return repo, err
+}
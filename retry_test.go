@@ -0,0 +1,36 @@
+package herfish
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: &fs.PathError{Op: "read", Path: "x", Err: syscall.EIO}, want: true},
+		{err: fmt.Errorf("wrapped: %w", syscall.ESTALE), want: true},
+		{err: syscall.EAGAIN, want: true},
+		{err: syscall.EINTR, want: true},
+		{err: os.ErrDeadlineExceeded, want: true},
+		{err: git.ErrRepositoryNotExists, want: false},
+		{err: plumbing.ErrObjectNotFound, want: false},
+		{err: fs.ErrPermission, want: false},
+		{err: ErrStatusTimeout, want: false},
+		{err: fmt.Errorf("index decoder: malformed"), want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isRetryable(tt.err); got != tt.want {
+			t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package herfish
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+
+	"github.com/go-git/go-git/v5"
+)
+
+var ErrStatusTimeout = errors.New("timed out getting worktree status")
+
+type repoError struct {
+	Dir      string
+	Category string
+	Err      error
+}
+
+func newRepoError(dir string, err error) repoError {
+	return repoError{Dir: dir, Category: errorCategory(err), Err: err}
+}
+
+func errorCategory(err error) string {
+	switch {
+	case errors.Is(err, ErrBrokenHead):
+		return "broken-head"
+	case errors.Is(err, ErrNoGitLog):
+		return "empty"
+	case errors.Is(err, ErrCorruptHead):
+		return "corrupt"
+	case errors.Is(err, ErrNoDefaultBranch):
+		return "no-default-branch"
+	case errors.Is(err, ErrStatusTimeout):
+		return "timeout"
+	case errors.Is(err, git.ErrIsBareRepository):
+		return "bare"
+	case errors.Is(err, git.ErrRepositoryNotExists):
+		return "not-repo"
+	case errors.Is(err, fs.ErrPermission):
+		return "permission"
+	}
+	return "other"
+}
+
+func logErrorSummary(scanErrors []repoError) {
+	if len(scanErrors) == 0 {
+		return
+	}
+
+	for _, e := range scanErrors {
+		slog.Warn("repo error", "dir", e.Dir, "category", e.Category, "error", e.Err)
+	}
+	slog.Warn("error summary", "count", len(scanErrors))
+}
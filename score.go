@@ -0,0 +1,32 @@
+package herfish
+
+import "time"
+
+func scoreEnabled() bool {
+	return opts.Sort == "score" || templateReferences("Score")
+}
+
+// attentionScore combines signals that a repository needs attention into a
+// single number; higher means more urgent. It is the weighted sum of
+//
+//	dirty worktree (1 when dirty, else 0) * --score-dirty-weight
+//	commits ahead of upstream              * --score-ahead-weight
+//	commits behind upstream                * --score-behind-weight
+//	days since the last commit             * --score-age-weight
+//
+// Unpushed and uncommitted work dominate by default, and age breaks ties
+// between otherwise similar repositories.
+func attentionScore(data templateData, now time.Time) float64 {
+	score := float64(data.Ahead)*opts.ScoreAheadWeight + float64(data.Behind)*opts.ScoreBehindWeight
+
+	if data.RepoStatus == "dirty" {
+		score += opts.ScoreDirtyWeight
+	}
+
+	if !data.LastCommitTime.IsZero() {
+		days := now.Sub(data.LastCommitTime).Hours() / 24
+		score += max(days, 0) * opts.ScoreAgeWeight
+	}
+
+	return score
+}
@@ -0,0 +1,402 @@
+package herfish
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// sentinelMatcher decides whether a directory contains the sentinel, either
+// by exact name or by glob, optionally ignoring case. When skipGitlinks is
+// set, a .git file pointing elsewhere does not count as a match.
+type sentinelMatcher struct {
+	name            string
+	glob            string
+	caseInsensitive bool
+	skipGitlinks    bool
+}
+
+func newSentinelMatcher(name, glob string, caseInsensitive, skipGitlinks bool) (sentinelMatcher, error) {
+	if glob != "" {
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return sentinelMatcher{}, fmt.Errorf("invalid sentinel glob %q: %w", glob, err)
+		}
+	}
+
+	return sentinelMatcher{name: name, glob: glob, caseInsensitive: caseInsensitive, skipGitlinks: skipGitlinks}, nil
+}
+
+// sentinelMatchers picks the matcher for each input path: the one built from
+// a per-line sentinel when the path had one, the global matcher otherwise.
+type sentinelMatchers struct {
+	global    sentinelMatcher
+	overrides map[string]sentinelMatcher
+}
+
+func newSentinelMatchers(lineSentinels map[string]string) (sentinelMatchers, error) {
+	skipGitlinks := opts.SubmoduleRepos == "false"
+
+	global, err := newSentinelMatcher(opts.Sentinel, opts.SentinelGlob, opts.SentinelCI, skipGitlinks)
+	if err != nil {
+		return sentinelMatchers{}, err
+	}
+
+	overrides := make(map[string]sentinelMatcher, len(lineSentinels))
+	for path, sentinel := range lineSentinels {
+		matcher, err := newSentinelMatcher(sentinel, "", opts.SentinelCI, skipGitlinks)
+		if err != nil {
+			return sentinelMatchers{}, err
+		}
+		overrides[path] = matcher
+	}
+
+	return sentinelMatchers{global: global, overrides: overrides}, nil
+}
+
+func (m sentinelMatchers) forPath(path string) sentinelMatcher {
+	if matcher, ok := m.overrides[path]; ok {
+		return matcher
+	}
+	return m.global
+}
+
+// splitLineSentinels splits input lines of the form path<TAB>sentinel,
+// recording each sentinel in lineSentinels, and returns the bare paths.
+func splitLineSentinels(lines []string, lineSentinels map[string]string) []string {
+	paths := make([]string, 0, len(lines))
+	for _, line := range lines {
+		path, sentinel, _ := strings.Cut(line, "\t")
+		path, sentinel = strings.TrimSpace(path), strings.TrimSpace(sentinel)
+		if sentinel != "" {
+			lineSentinels[path] = sentinel
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func (m sentinelMatcher) String() string {
+	if m.glob != "" {
+		return m.glob
+	}
+	return m.name
+}
+
+// match reports whether dir contains the sentinel and returns the name of
+// the entry that matched.
+func (m sentinelMatcher) match(dir string) (string, bool) {
+	// An exact, case-sensitive name needs only a single stat.
+	if m.glob == "" && !m.caseInsensitive {
+		info, err := os.Stat(filepath.Join(dir, m.name))
+		return m.name, err == nil && !m.skipEntry(m.name, info.IsDir())
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		slog.Debug("failed to read dir", "dir", dir, "error", err)
+		return "", false
+	}
+
+	for _, entry := range entries {
+		if m.matchName(entry.Name()) && !m.skipEntry(entry.Name(), entry.IsDir()) {
+			return entry.Name(), true
+		}
+	}
+
+	return "", false
+}
+
+// skipEntry reports whether a matched entry is a submodule gitlink that
+// should be ignored.
+func (m sentinelMatcher) skipEntry(name string, isDir bool) bool {
+	if m.skipGitlinks && !isDir && name == ".git" {
+		slog.Debug("ignoring gitlink sentinel", "name", name)
+		return true
+	}
+	return false
+}
+
+func (m sentinelMatcher) matchName(name string) bool {
+	if m.glob == "" {
+		if m.caseInsensitive {
+			return strings.EqualFold(name, m.name)
+		}
+		return name == m.name
+	}
+
+	pattern := m.glob
+	if m.caseInsensitive {
+		pattern = strings.ToLower(pattern)
+		name = strings.ToLower(name)
+	}
+
+	matched, _ := filepath.Match(pattern, name)
+	return matched
+}
+
+// enclosingRoot returns the parent of the outermost path component that is
+// itself a sentinel, so a path like /repo/.git/objects normalizes to /repo.
+func (m sentinelMatcher) enclosingRoot(path string) (string, bool) {
+	parts := strings.Split(filepath.Clean(path), string(filepath.Separator))
+	for i, part := range parts {
+		if i > 0 && part != "" && m.matchName(part) {
+			root := strings.Join(parts[:i], string(filepath.Separator))
+			if root == "" {
+				root = string(filepath.Separator)
+			}
+			return root, true
+		}
+	}
+	return "", false
+}
+
+func showSentinelEnabled() bool {
+	return opts.ShowSentinel || templateReferences("Sentinel")
+}
+
+// findSentinelDirs walks upward from each path to the nearest directory
+// containing the sentinel. Every input is treated the same regardless of its
+// position: a directory is checked itself first, so a repo root given
+// directly is reported as that repo, while a file's search reaches its
+// containing directory at depth 1. Each repo appears once and the result is
+// sorted, so it depends only on the set of paths, not their order. Paths
+// reaching the same repo through symlinks are reported once. The
+// returned map holds the sentinel name that matched in each dir.
+//
+// With a sentinelDepth of 0 or more the search goes down instead: only dirs
+// exactly that many levels below each input are checked, as in
+// input/*/.git for a depth of 1.
+//
+// Up to concurrency paths are walked at once. Hits are merged in input order
+// afterwards, so the result is the same as a serial walk.
+func findSentinelDirs(paths []string, matchers sentinelMatchers, sentinelDepth, concurrency int) ([]string, map[string]string, error) {
+	found := &foundDirs{dirs: make(map[string]sentinelMatcher)}
+	hits := make([]sentinelHits, len(paths))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for range max(concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				matcher := matchers.forPath(paths[i])
+				if sentinelDepth == -1 {
+					hits[i] = walkToSentinel(paths[i], matcher, found)
+				} else {
+					hits[i] = sentinelsBelow(paths[i], matcher, sentinelDepth)
+				}
+			}
+		}()
+	}
+
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	matched := make(map[string]string)
+	var result []string
+	for _, hit := range hits {
+		if hit.err != nil {
+			return []string{}, nil, hit.err
+		}
+		for _, dir := range hit.dirs {
+			if _, seen := matched[dir.dir]; !seen {
+				result = append(result, dir.dir)
+				matched[dir.dir] = dir.name
+			}
+		}
+	}
+
+	sort.Strings(result)
+
+	return dedupeCanonical(result), matched, nil
+}
+
+// sentinelHits is the outcome of searching from one input path.
+type sentinelHits struct {
+	dirs []sentinelDir
+	err  error
+}
+
+// sentinelDir is a dir containing the sentinel and the entry that matched.
+type sentinelDir struct {
+	dir  string
+	name string
+}
+
+// foundDirs records the matcher that reported each sentinel dir so far,
+// shared by the discovery workers.
+type foundDirs struct {
+	mu   sync.Mutex
+	dirs map[string]sentinelMatcher
+}
+
+func (f *foundDirs) reportedBy(dir string, matcher sentinelMatcher) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	found, ok := f.dirs[dir]
+	return ok && found == matcher
+}
+
+func (f *foundDirs) add(dir string, matcher sentinelMatcher) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dirs[dir] = matcher
+}
+
+// startDir resolves path to the absolute dir a search starts from, with a
+// path inside a sentinel normalized to the dir holding that sentinel.
+func startDir(path string, matcher sentinelMatcher) (string, error) {
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("failed to stat path: %w", err)
+	}
+
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	if root, ok := matcher.enclosingRoot(dir); ok {
+		slog.Debug("path is inside sentinel dir", "path", path, "root", root)
+		dir = root
+	}
+
+	return dir, nil
+}
+
+func walkToSentinel(path string, matcher sentinelMatcher, found *foundDirs) sentinelHits {
+	currentDir, err := startDir(path, matcher)
+	if err != nil {
+		return sentinelHits{err: err}
+	}
+
+	slog.Debug("searching for sentinel dir", "path", path, "currentDir", currentDir, "sentinel", matcher)
+
+	for currentDir != "/" {
+		// Reaching a dir this matcher already reported means the walk
+		// would end there too. With a different per-line sentinel the walk
+		// could continue past it, so it must not stop early or the result
+		// would depend on input order.
+		if found.reportedBy(currentDir, matcher) {
+			break
+		}
+
+		if name, ok := matcher.match(currentDir); ok {
+			if opts.MainReposOnly && isGitlink(currentDir, name) {
+				slog.Debug("skipping linked worktree or submodule", "dir", currentDir)
+				break
+			}
+			found.add(currentDir, matcher)
+			return sentinelHits{dirs: []sentinelDir{{dir: currentDir, name: name}}}
+		}
+
+		currentDir = filepath.Dir(currentDir)
+	}
+
+	return sentinelHits{}
+}
+
+// sentinelsBelow checks the dirs exactly depth levels below path for the
+// sentinel. A file input searches from its containing dir. Symlinked dirs
+// and sentinel dirs themselves are not descended into.
+func sentinelsBelow(path string, matcher sentinelMatcher, depth int) sentinelHits {
+	root, err := startDir(path, matcher)
+	if err != nil {
+		return sentinelHits{err: err}
+	}
+	if info, err := os.Stat(root); err == nil && !info.IsDir() {
+		root = filepath.Dir(root)
+	}
+
+	slog.Debug("searching below for sentinel dirs", "path", path, "root", root, "sentinel", matcher, "sentinelDepth", depth)
+
+	level := []string{root}
+	for range depth {
+		var next []string
+		for _, dir := range level {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				slog.Debug("failed to read dir", "dir", dir, "error", err)
+				continue
+			}
+			for _, entry := range entries {
+				if entry.IsDir() && !matcher.matchName(entry.Name()) {
+					next = append(next, filepath.Join(dir, entry.Name()))
+				}
+			}
+		}
+		level = next
+	}
+
+	var hits sentinelHits
+	for _, dir := range level {
+		name, ok := matcher.match(dir)
+		if !ok {
+			continue
+		}
+		if opts.MainReposOnly && isGitlink(dir, name) {
+			slog.Debug("skipping linked worktree or submodule", "dir", dir)
+			continue
+		}
+		hits.dirs = append(hits.dirs, sentinelDir{dir: dir, name: name})
+	}
+	return hits
+}
+
+// dedupeCanonical drops dirs that resolve through symlinks to a repo already
+// in the list. dirs must be sorted, so the lexically smallest path to each
+// repo is kept no matter which input reached it first.
+func dedupeCanonical(dirs []string) []string {
+	seen := make(map[string]string)
+	var result []string
+	for _, dir := range dirs {
+		canonical, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			canonical = dir
+		}
+		if first, ok := seen[canonical]; ok {
+			slog.Debug("skipping duplicate of repo reached via another path", "dir", dir, "kept", first, "canonical", canonical)
+			continue
+		}
+		seen[canonical] = dir
+		result = append(result, dir)
+	}
+	return result
+}
+
+// skipRemoteFS drops dirs on network filesystems. Detection is best effort
+// and only implemented on Linux; other platforms keep every dir.
+func skipRemoteFS(dirs []string) []string {
+	var local []string
+	for _, dir := range dirs {
+		if remote, fsType := isRemoteFS(dir); remote {
+			slog.Info("skipping repo on network filesystem", "dir", dir, "fsType", fsType)
+			continue
+		}
+		local = append(local, dir)
+	}
+	return local
+}
+
+// skipInvalidRepos drops dirs whose sentinel is not a repository git can
+// open. It opens each dir once without retries, since junk is not transient.
+func skipInvalidRepos(dirs []string) []string {
+	var valid []string
+	for _, dir := range dirs {
+		if _, err := git.PlainOpen(dir); err != nil {
+			slog.Info("skipping invalid repository", "dir", dir, "error", err)
+			continue
+		}
+		valid = append(valid, dir)
+	}
+	return valid
+}
@@ -0,0 +1,260 @@
+package herfish
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// findDirs runs findSentinelDirs with the default matcher.
+func findDirs(t *testing.T, paths []string, concurrency int) []string {
+	t.Helper()
+
+	matchers, err := newSentinelMatchers(nil)
+	if err != nil {
+		t.Fatalf("failed to build matchers: %v", err)
+	}
+	dirs, _, err := findSentinelDirs(paths, matchers, opts.SentinelDepth, concurrency)
+	if err != nil {
+		t.Fatalf("findSentinelDirs: %v", err)
+	}
+	return dirs
+}
+
+// nestedRepos creates an outer repo containing an inner repo and a plain
+// subdirectory, and returns the outer and inner repo paths.
+func nestedRepos(t *testing.T) (string, string) {
+	t.Helper()
+
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	outer := filepath.Join(root, "outer")
+	inner := filepath.Join(outer, "vendor", "inner")
+	for _, dir := range []string{outer, inner} {
+		if err := genFixture(dir, 1, false); err != nil {
+			t.Fatalf("failed to create fixture: %v", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(outer, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return outer, inner
+}
+
+func TestFindSentinelDirsDirectoryAndFileInputs(t *testing.T) {
+	setOptions(t)
+	outer, inner := nestedRepos(t)
+
+	tests := []struct {
+		name  string
+		paths []string
+		want  []string
+	}{
+		{
+			name:  "repo root as first input",
+			paths: []string{outer},
+			want:  []string{outer},
+		},
+		{
+			name:  "repo root after another input",
+			paths: []string{filepath.Join(inner, "README"), outer},
+			want:  []string{outer, inner},
+		},
+		{
+			name:  "file reaches its containing repo",
+			paths: []string{filepath.Join(outer, "README")},
+			want:  []string{outer},
+		},
+		{
+			name:  "plain subdirectory walks up",
+			paths: []string{filepath.Join(outer, "src")},
+			want:  []string{outer},
+		},
+		{
+			name:  "nested repo dir reports itself in any position",
+			paths: []string{filepath.Join(outer, "README"), inner, filepath.Join(outer, "src")},
+			want:  []string{outer, inner},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findDirs(t, tt.paths, 1)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("findSentinelDirs(%v) = %v, want %v", tt.paths, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindSentinelDirsIgnoresInputOrder(t *testing.T) {
+	setOptions(t)
+	outer, inner := nestedRepos(t)
+
+	paths := []string{
+		outer,
+		inner,
+		filepath.Join(outer, "README"),
+		filepath.Join(outer, "src"),
+		filepath.Join(inner, "README"),
+		filepath.Join(outer, ".git", "objects"),
+	}
+	want := findDirs(t, paths, 1)
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	for range 50 {
+		shuffled := slices.Clone(paths)
+		rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+		if got := findDirs(t, shuffled, 1); !slices.Equal(got, want) {
+			t.Fatalf("findSentinelDirs(%v) = %v, want %v", shuffled, got, want)
+		}
+	}
+}
+
+func TestEnclosingRoot(t *testing.T) {
+	matcher, err := newSentinelMatcher(".git", "", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path   string
+		want   string
+		wantOK bool
+	}{
+		{path: "/repo/.git", want: "/repo", wantOK: true},
+		{path: "/repo/.git/", want: "/repo", wantOK: true},
+		{path: "/repo/.git/objects", want: "/repo", wantOK: true},
+		{path: "/repo/.git/objects/pack", want: "/repo", wantOK: true},
+		{path: "/.git", want: "/", wantOK: true},
+		{path: "/outer/.git/modules/inner/.git", want: "/outer", wantOK: true},
+		{path: "/repo", wantOK: false},
+		{path: "/repo/src/main.go", wantOK: false},
+		{path: "/repo/.github", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		got, ok := matcher.enclosingRoot(tt.path)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("enclosingRoot(%q) = %q, %v, want %q, %v", tt.path, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestFindSentinelDirsInsideGitDir(t *testing.T) {
+	setOptions(t)
+	outer, _ := nestedRepos(t)
+
+	for _, path := range []string{filepath.Join(outer, ".git"), filepath.Join(outer, ".git", "objects")} {
+		if got := findDirs(t, []string{path}, 1); !slices.Equal(got, []string{outer}) {
+			t.Errorf("findSentinelDirs(%q) = %v, want [%s]", path, got, outer)
+		}
+	}
+}
+
+func TestFindSentinelDirsSymlinksToOneRepo(t *testing.T) {
+	setOptions(t)
+	outer, _ := nestedRepos(t)
+
+	links := t.TempDir()
+	one := filepath.Join(links, "one")
+	two := filepath.Join(links, "two")
+	for _, link := range []string{one, two} {
+		if err := os.Symlink(outer, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := findDirs(t, []string{two, one}, 1)
+	if len(got) != 1 {
+		t.Fatalf("findSentinelDirs = %v, want one result", got)
+	}
+	if got[0] != one {
+		t.Errorf("findSentinelDirs = %v, want the lexically smallest path %s", got, one)
+	}
+}
+
+func TestDedupeCanonical(t *testing.T) {
+	root := t.TempDir()
+	repo := filepath.Join(root, "repo")
+	if err := os.Mkdir(repo, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(root, "alias")
+	if err := os.Symlink(repo, link); err != nil {
+		t.Fatal(err)
+	}
+
+	got := dedupeCanonical([]string{link, repo})
+	if !slices.Equal(got, []string{link}) {
+		t.Errorf("dedupeCanonical = %v, want [%s]", got, link)
+	}
+}
+
+func BenchmarkFindSentinelDirs(b *testing.B) {
+	setOptions(b)
+
+	var paths []string
+	for _, dir := range genFixtures(b, 50) {
+		deep := filepath.Join(dir, "a", "b", "c", "d", "e", "f")
+		if err := os.MkdirAll(deep, 0o755); err != nil {
+			b.Fatal(err)
+		}
+		for range 20 {
+			paths = append(paths, deep, filepath.Join(dir, "README"))
+		}
+	}
+
+	matchers, err := newSentinelMatchers(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, concurrency := range []int{1, 8} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			for range b.N {
+				if _, _, err := findSentinelDirs(paths, matchers, -1, concurrency); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestFindSentinelDirsBelowAtExactDepth(t *testing.T) {
+	setOptions(t)
+	outer, inner := nestedRepos(t)
+	root := filepath.Dir(outer)
+
+	tests := []struct {
+		path  string
+		depth int
+		want  []string
+	}{
+		{path: root, depth: 0, want: nil},
+		{path: root, depth: 1, want: []string{outer}},
+		{path: root, depth: 2, want: nil},
+		{path: root, depth: 3, want: []string{inner}},
+		{path: outer, depth: 0, want: []string{outer}},
+		{path: filepath.Join(outer, "README"), depth: 2, want: []string{inner}},
+	}
+
+	for _, tt := range tests {
+		matchers, err := newSentinelMatchers(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _, err := findSentinelDirs([]string{tt.path}, matchers, tt.depth, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("findSentinelDirs(%q, depth %d) = %v, want %v", tt.path, tt.depth, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package herfish
+
+import (
+	"io/fs"
+	"path/filepath"
+)
+
+// dirSize sums the sizes of regular files under root. Directories for which
+// skipDir returns true are not descended into.
+func dirSize(root string, skipDir func(path string, d fs.DirEntry) bool) (int64, error) {
+	var total int64
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if skipDir != nil && skipDir(path, d) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+
+		return nil
+	})
+
+	return total, err
+}
+
+// worktreeSize measures the working tree of the repo at dir, excluding .git.
+func worktreeSize(dir string) (int64, error) {
+	return dirSize(dir, func(path string, d fs.DirEntry) bool {
+		return d.Name() == ".git"
+	})
+}
@@ -0,0 +1,45 @@
+package herfish
+
+import (
+	"sort"
+)
+
+// sortResults orders dataCollection by key. Repos with equal keys keep their
+// path order, so output is deterministic.
+func sortResults(dataCollection []templateData, key string) {
+	sort.SliceStable(dataCollection, func(i, j int) bool {
+		return dataCollection[i].Dir < dataCollection[j].Dir
+	})
+
+	var less func(a, b templateData) bool
+	switch key {
+	case "commits":
+		less = func(a, b templateData) bool { return a.CommitCount < b.CommitCount }
+	case "status":
+		less = func(a, b templateData) bool { return a.RepoStatus < b.RepoStatus }
+	case "last-commit":
+		less = func(a, b templateData) bool { return a.LastCommitTime.After(b.LastCommitTime) }
+	case "score":
+		less = func(a, b templateData) bool { return a.Score > b.Score }
+	case "dirty-first":
+		less = func(a, b templateData) bool { return dirtyFirstRank(a.RepoStatus) < dirtyFirstRank(b.RepoStatus) }
+	default:
+		return
+	}
+
+	sort.SliceStable(dataCollection, func(i, j int) bool {
+		return less(dataCollection[i], dataCollection[j])
+	})
+}
+
+// dirtyFirstRank orders statuses for triage: dirty, then clean, then
+// everything else (unknown, error, timeout, corrupt, skipped).
+func dirtyFirstRank(status string) int {
+	switch status {
+	case "dirty":
+		return 0
+	case "clean":
+		return 1
+	}
+	return 2
+}
@@ -0,0 +1,80 @@
+package herfish
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSortResults(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		data []templateData
+		want []string
+	}{
+		{
+			name: "equal commit counts keep path order",
+			key:  "commits",
+			data: []templateData{
+				{Dir: "/c", CommitCount: 5},
+				{Dir: "/a", CommitCount: 5},
+				{Dir: "/b", CommitCount: 5},
+			},
+			want: []string{"/a", "/b", "/c"},
+		},
+		{
+			name: "commits ascending with ties by path",
+			key:  "commits",
+			data: []templateData{
+				{Dir: "/d", CommitCount: 7},
+				{Dir: "/c", CommitCount: 2},
+				{Dir: "/b", CommitCount: 7},
+				{Dir: "/a", CommitCount: 2},
+			},
+			want: []string{"/a", "/c", "/b", "/d"},
+		},
+		{
+			name: "status with ties by path",
+			key:  "status",
+			data: []templateData{
+				{Dir: "/c", RepoStatus: "dirty"},
+				{Dir: "/b", RepoStatus: "clean"},
+				{Dir: "/a", RepoStatus: "dirty"},
+			},
+			want: []string{"/b", "/a", "/c"},
+		},
+		{
+			name: "dirty first",
+			key:  "dirty-first",
+			data: []templateData{
+				{Dir: "/a", RepoStatus: "unknown"},
+				{Dir: "/b", RepoStatus: "clean"},
+				{Dir: "/c", RepoStatus: "dirty"},
+			},
+			want: []string{"/c", "/b", "/a"},
+		},
+		{
+			name: "unknown key sorts by path",
+			key:  "",
+			data: []templateData{
+				{Dir: "/b"},
+				{Dir: "/a"},
+			},
+			want: []string{"/a", "/b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sortResults(tt.data, tt.key)
+
+			var got []string
+			for _, data := range tt.data {
+				got = append(got, data.Dir)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("sortResults(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package herfish
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const spinnerInterval = 100 * time.Millisecond
+
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+// spinner shows a live count of analyzed repositories on stderr. A nil
+// spinner is valid and does nothing, which is what startSpinner returns when
+// stderr is not a terminal.
+type spinner struct {
+	total int
+	done  atomic.Int64
+	quit  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func startSpinner(total int) *spinner {
+	if !isTerminal(os.Stderr) || total == 0 {
+		return nil
+	}
+
+	s := &spinner{total: total, quit: make(chan struct{})}
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+func (s *spinner) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(spinnerInterval)
+	defer ticker.Stop()
+
+	for frame := 0; ; frame++ {
+		fmt.Fprintf(os.Stderr, "\r\033[K%s %d/%d repos", spinnerFrames[frame%len(spinnerFrames)], s.done.Load(), s.total)
+
+		select {
+		case <-s.quit:
+			fmt.Fprint(os.Stderr, "\r\033[K")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *spinner) increment() {
+	if s == nil {
+		return
+	}
+	s.done.Add(1)
+}
+
+// stop clears the spinner line so final results start on a clean line.
+func (s *spinner) stop() {
+	if s == nil {
+		return
+	}
+	close(s.quit)
+	s.wg.Wait()
+}
@@ -0,0 +1,21 @@
+package herfish
+
+import "time"
+
+func stashEnabled() bool {
+	return opts.StaleStashOlderThan != "" || templateReferences("StashCount") || templateReferences("OldestStashAge")
+}
+
+// stashInfo returns the number of stash entries and the age of the oldest
+// one, taken from the refs/stash reflog where git records each stash.
+func stashInfo(dir string, now time.Time) (int, time.Duration, error) {
+	entries, err := readReflog(dir, "refs/stash")
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(entries) == 0 {
+		return 0, 0, nil
+	}
+
+	return len(entries), now.Sub(entries[0].when), nil
+}
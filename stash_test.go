@@ -0,0 +1,25 @@
+package herfish
+
+import "testing"
+
+func TestStashEnabled(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{args: nil, want: false},
+		{args: []string{"--template", "{{.StashCount}}"}, want: true},
+		{args: []string{"--template", "{{.OldestStashAge}}"}, want: true},
+		{args: []string{"--fields", "dir,stash_count"}, want: true},
+		{args: []string{"--fields", "oldest_stash_age_ns"}, want: true},
+		{args: []string{"--stale-stash-older-than", "0s"}, want: true},
+		{args: []string{"--template", "{{.Dir}}"}, want: false},
+	}
+
+	for _, tt := range tests {
+		setOptions(t, tt.args...)
+		if got := stashEnabled(); got != tt.want {
+			t.Errorf("stashEnabled() with %v = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package herfish
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// jsonStreamWriter writes a JSON array one element at a time so the full
+// result set never has to be held in memory.
+type jsonStreamWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (s *jsonStreamWriter) write(data templateData) error {
+	b, err := marshalJSON(data, false)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", data.Dir, err)
+	}
+
+	prefix := ","
+	if s.count == 0 {
+		prefix = "["
+	}
+	s.count++
+
+	_, err = fmt.Fprint(s.w, prefix, string(b))
+	return err
+}
+
+func (s *jsonStreamWriter) close() error {
+	if s.count == 0 {
+		_, err := fmt.Fprintln(s.w, "[]")
+		return err
+	}
+	_, err := fmt.Fprintln(s.w, "]")
+	return err
+}
+
+// streamRepos analyzes dirs concurrently and sends each result as soon as it
+// is ready, in completion order.
+func streamRepos(dirs []string, concurrency int) <-chan repoResult {
+	results := make(chan repoResult)
+	jobs := make(chan string)
+
+	var wg sync.WaitGroup
+	for range max(concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dir := range jobs {
+				if deadlineExceeded() {
+					results <- repoResult{skipped: true}
+					continue
+				}
+				results <- analyzeRepo(dir)
+			}
+		}()
+	}
+
+	go func() {
+		for _, dir := range dirs {
+			jobs <- dir
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// streamJSON writes each repository that passes the filters as soon as it
+// has been analyzed. Sorting, sampling, origin dedupe and percentiles need the
+// whole result set and are not applied.
+func streamJSON(pathCount int, sentinelDirs []string, sentinelNames map[string]string, manifest []manifestEntry, start time.Time) error {
+	w := io.Writer(os.Stdout)
+	if opts.OutputFile != "" {
+		f, err := os.Create(opts.OutputFile)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	stream := &jsonStreamWriter{w: w}
+	var scanErrors []repoError
+	var fatal error
+	skipped, analyzed := 0, 0
+
+	for result := range streamRepos(sentinelDirs, opts.Concurrency) {
+		if result.skipped {
+			skipped++
+			continue
+		}
+		scanErrors = append(scanErrors, result.errs...)
+		if fatal != nil {
+			continue
+		}
+		analyzed++
+
+		annotateResult(&result.data, manifest, sentinelNames)
+		for _, data := range applyFilters([]templateData{result.data}) {
+			if opts.MaxResults > 0 && stream.count >= opts.MaxResults {
+				break
+			}
+			data.Dir = displayDir(data)
+			if err := stream.write(data); err != nil {
+				fatal = fmt.Errorf("failed to write output: %w", err)
+			}
+		}
+	}
+
+	// The array is closed even after a fatal error so consumers still get
+	// valid JSON holding the results written before it.
+	if err := stream.close(); err != nil {
+		slog.Error("failed to write output", "error", err)
+	}
+
+	if fatal != nil {
+		return fatal
+	}
+
+	logErrorSummary(scanErrors)
+	logScanStats(pathCount, len(sentinelDirs), analyzed-stream.count, len(scanErrors), start)
+
+	return scanError(skipped, stream.count)
+}
@@ -0,0 +1,30 @@
+package herfish
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONStreamWriterProducesValidJSON(t *testing.T) {
+	for _, n := range []int{0, 1, 3} {
+		var buf bytes.Buffer
+		stream := &jsonStreamWriter{w: &buf}
+		for range n {
+			if err := stream.write(templateData{Dir: "/a"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := stream.close(); err != nil {
+			t.Fatal(err)
+		}
+
+		var got []templateData
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("%d results: invalid JSON %q: %v", n, buf.String(), err)
+		}
+		if len(got) != n {
+			t.Errorf("decoded %d results, want %d", len(got), n)
+		}
+	}
+}
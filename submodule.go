@@ -0,0 +1,38 @@
+package herfish
+
+import (
+	"os"
+	"path/filepath"
+)
+
+func submoduleEnabled() bool {
+	return opts.SkipSubmodules || templateReferences("Submodule")
+}
+
+// isSubmodule reports whether dir sits inside another repository's tree,
+// which covers registered submodules as well as ones removed from
+// .gitmodules whose directories were left behind.
+func isSubmodule(dir string) bool {
+	parent := filepath.Dir(dir)
+	for parent != "/" && parent != "." {
+		if _, err := os.Stat(filepath.Join(parent, ".git")); err == nil {
+			return true
+		}
+		next := filepath.Dir(parent)
+		if next == parent {
+			break
+		}
+		parent = next
+	}
+	return false
+}
+
+// isGitlink reports whether the sentinel name in dir is a .git file, as in
+// linked worktrees and submodule checkouts, rather than a .git directory.
+func isGitlink(dir, name string) bool {
+	if name != ".git" {
+		return false
+	}
+	info, err := os.Lstat(filepath.Join(dir, name))
+	return err == nil && info.Mode().IsRegular()
+}
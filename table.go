@@ -0,0 +1,64 @@
+package herfish
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+func tableRows(filteredData []templateData) [][]string {
+	countCommits := countingEnabled()
+
+	header := []string{"DIR"}
+	if countCommits {
+		header = []string{"COMMITS", "STATUS", "DIR"}
+	}
+
+	rows := [][]string{header}
+	for _, data := range filteredData {
+		row := []string{data.Dir}
+		if countCommits {
+			row = []string{strconv.Itoa(data.CommitCount), data.RepoStatus, data.Dir}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// writeTable renders rows as a bordered ASCII table whose first row is the
+// header. Each column is as wide as its widest cell, measured in runes to
+// match fmt's padding, so non-ASCII paths stay aligned.
+func writeTable(w io.Writer, rows [][]string) {
+	if len(rows) == 0 {
+		return
+	}
+
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+
+	var border strings.Builder
+	border.WriteString("+")
+	for _, width := range widths {
+		border.WriteString(strings.Repeat("-", width+2) + "+")
+	}
+
+	fmt.Fprintln(w, border.String())
+	for i, row := range rows {
+		line := "|"
+		for j, cell := range row {
+			line += fmt.Sprintf(" %-*s |", widths[j], cell)
+		}
+		fmt.Fprintln(w, line)
+		if i == 0 {
+			fmt.Fprintln(w, border.String())
+		}
+	}
+	fmt.Fprintln(w, border.String())
+}
@@ -0,0 +1,22 @@
+package herfish
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteTableSizesNonASCIICellsByRunes(t *testing.T) {
+	var buf bytes.Buffer
+	writeTable(&buf, [][]string{{"DIR"}, {"/src/café"}, {"/src/日本語"}})
+
+	want := "+-----------+"
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		if strings.HasPrefix(line, "+") && line != want {
+			t.Errorf("border = %q, want %q", line, want)
+		}
+	}
+	if !strings.Contains(buf.String(), "| /src/café |\n") {
+		t.Errorf("widest cell is padded:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,51 @@
+package herfish
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+)
+
+const clearScreen = "\033[H\033[2J"
+
+// watch rescans paths every interval until interrupted. The screen is cleared
+// between scans when stdout is a terminal.
+func watch(paths []string, manifest []manifestEntry, lineSentinels map[string]string, interval time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if isTerminal(os.Stdout) {
+			fmt.Print(clearScreen)
+		}
+
+		if err := scan(paths, manifest, lineSentinels); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// isTerminal reports whether f is a character device other than the null
+// device, which is a character device too but never a person at a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+
+	if null, err := os.Stat(os.DevNull); err == nil && os.SameFile(info, null) {
+		return false
+	}
+	return true
+}